@@ -10,17 +10,32 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/princetheprogrammerbtw/nanoci/internal/artifact"
 	"github.com/princetheprogrammerbtw/nanoci/internal/auth"
 	"github.com/princetheprogrammerbtw/nanoci/internal/config"
 	"github.com/princetheprogrammerbtw/nanoci/internal/db"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"github.com/princetheprogrammerbtw/nanoci/internal/events"
+	"github.com/princetheprogrammerbtw/nanoci/internal/logstore"
+	"github.com/princetheprogrammerbtw/nanoci/internal/notify"
 	"github.com/princetheprogrammerbtw/nanoci/internal/queue"
 	"github.com/princetheprogrammerbtw/nanoci/internal/repository/postgres"
+	"github.com/princetheprogrammerbtw/nanoci/internal/scm"
+	"github.com/princetheprogrammerbtw/nanoci/internal/server/eventstream"
 	"github.com/princetheprogrammerbtw/nanoci/internal/server/handlers"
 	"github.com/princetheprogrammerbtw/nanoci/internal/server/logstream"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 )
 
+const (
+	sweepInterval      = time.Hour
+	notifyDrainTimeout = 30 * time.Second
+	// Stored webhook payloads are kept long enough to outlast provider
+	// retries and be redelivered, then swept.
+	webhookDeliveryRetention = 30 * 24 * time.Hour
+)
+
 func main() {
 	logger, _ := zap.NewProduction()
 	defer logger.Sync()
@@ -53,20 +68,51 @@ func main() {
 	projectRepo := postgres.NewProjectRepository(pool)
 	buildRepo := postgres.NewBuildRepository(pool)
 	secretRepo := postgres.NewSecretRepository(pool)
+	stepRepo := postgres.NewStepRepository(pool)
+	artifactRepo := postgres.NewArtifactRepository(pool)
+	notificationRepo := postgres.NewNotificationRepository(pool)
+	webhookDeliveryRepo := postgres.NewWebhookDeliveryRepository(pool)
 
 	// Initialize Queue
 	q := queue.NewRedisQueue(rdb)
 
+	// Initialize Event Bus
+	bus := events.NewRedisBus(rdb)
+
+	// Initialize Log Store
+	logStore, err := logstore.New(cfg)
+	if err != nil {
+		zap.L().Fatal("failed to initialize log store", zap.Error(err))
+	}
+
+	// Initialize Artifact Store
+	artifactStore, err := artifact.New(cfg)
+	if err != nil {
+		zap.L().Fatal("failed to initialize artifact store", zap.Error(err))
+	}
+
+	// Initialize SCM Providers, which also report commit statuses
+	providers, err := scm.NewRegistry(projectRepo, cfg)
+	if err != nil {
+		zap.L().Fatal("failed to initialize scm providers", zap.Error(err))
+	}
+
 	// Initialize Services
 	authService := auth.NewAuthService(cfg, userRepo)
-	logManager := logstream.NewLogManager(rdb)
+	logManager := logstream.NewLogManager(rdb, buildRepo)
+	eventManager := eventstream.NewEventManager(bus)
+	notifier := notify.NewNotifier(notificationRepo, buildRepo, projectRepo, cfg)
 
 	// Initialize Handlers
 	authHandler := handlers.NewAuthHandler(authService)
-	webhookHandler := handlers.NewWebhookHandler(projectRepo, buildRepo, q)
-	projectHandler := handlers.NewProjectHandler(projectRepo)
-	buildHandler := handlers.NewBuildHandler(buildRepo)
+	webhookHandler := handlers.NewWebhookHandler(projectRepo, buildRepo, webhookDeliveryRepo, q, bus, providers)
+	projectHandler := handlers.NewProjectHandler(projectRepo, cfg.EncryptionKey)
+	buildHandler := handlers.NewBuildHandler(buildRepo, stepRepo, q, bus, providers, notifier)
+	logHandler := handlers.NewLogHandler(buildRepo, stepRepo, logStore)
+	artifactHandler := handlers.NewArtifactHandler(buildRepo, artifactRepo, artifactStore)
 	secretHandler := handlers.NewSecretHandler(secretRepo, cfg.EncryptionKey)
+	pipelineHandler := handlers.NewPipelineHandler()
+	notificationHandler := handlers.NewNotificationHandler(notificationRepo, cfg.EncryptionKey)
 
 	// Setup Router
 	r := chi.NewRouter()
@@ -85,6 +131,8 @@ func main() {
 		logManager.HandleWS(w, r, buildID)
 	})
 
+	r.Get("/ws/events", eventManager.HandleWS)
+
 	r.Route("/api/v1", func(r chi.Router) {
 // ...
 		r.Route("/projects", func(r chi.Router) {
@@ -95,9 +143,26 @@ func main() {
 				r.Get("/builds", buildHandler.ListByProject)
 				r.Get("/secrets", secretHandler.List)
 				r.Post("/secrets", secretHandler.Create)
+				r.Put("/credentials", projectHandler.SetCredential)
+				r.Delete("/credentials", projectHandler.DeleteCredential)
+				r.Post("/webhook-secret", projectHandler.RotateWebhookSecret)
+				r.Get("/webhook-deliveries", webhookHandler.Deliveries)
+				r.Post("/webhook-deliveries/{deliveryID}/redeliver", webhookHandler.Redeliver)
+				r.Get("/notifications", notificationHandler.List)
+				r.Post("/notifications", notificationHandler.Create)
+				r.Get("/notifications/deliveries", notificationHandler.Deliveries)
+				r.Delete("/notifications/{targetID}", notificationHandler.Delete)
 			})
 		})
 		r.Get("/builds/{id}", buildHandler.Get)
+		r.Get("/builds/{id}/children", buildHandler.ListChildren)
+		r.Get("/builds/{id}/steps", buildHandler.ListSteps)
+		r.Get("/builds/{id}/logs", logHandler.Get)
+		r.Post("/builds/{id}/cancel", buildHandler.Cancel)
+		r.Get("/builds/{id}/artifacts", artifactHandler.List)
+		r.Get("/builds/{id}/artifacts/{artifactID}", artifactHandler.Download)
+		r.Post("/pipelines/validate", pipelineHandler.Validate)
+		r.Get("/pipelines/schema.json", pipelineHandler.Schema)
 	})
 
 	r.Route("/auth", func(r chi.Router) {
@@ -105,7 +170,7 @@ func main() {
 		r.Get("/callback", authHandler.Callback)
 	})
 
-	r.Post("/webhooks/github", webhookHandler.HandleGithub)
+	r.Post("/webhooks/{provider}", webhookHandler.Handle)
 
 	// Server setup
 	srv := &http.Server{
@@ -113,6 +178,12 @@ func main() {
 		Handler: r,
 	}
 
+	// Remove expired artifacts and old webhook deliveries in the background
+	sweepCtx, stopSweeper := context.WithCancel(context.Background())
+	defer stopSweeper()
+	go artifact.NewSweeper(artifactRepo, artifactStore).Run(sweepCtx, sweepInterval)
+	go sweepWebhookDeliveries(sweepCtx, webhookDeliveryRepo, sweepInterval)
+
 	// Graceful Shutdown
 	go func() {
 		zap.L().Info("starting server", zap.String("port", cfg.Port))
@@ -134,5 +205,27 @@ func main() {
 		zap.L().Fatal("forced shutdown", zap.Error(err))
 	}
 
+	notifier.Close(notifyDrainTimeout)
+
 	zap.L().Info("server exited gracefully")
 }
+
+// sweepWebhookDeliveries deletes webhook deliveries older than
+// webhookDeliveryRetention every interval until ctx is done.
+func sweepWebhookDeliveries(ctx context.Context, repo domain.WebhookDeliveryRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := repo.DeleteOlderThan(ctx, time.Now().Add(-webhookDeliveryRetention))
+		if err != nil && ctx.Err() == nil {
+			zap.L().Error("failed to sweep webhook deliveries", zap.Error(err))
+		} else if n > 0 {
+			zap.L().Info("swept webhook deliveries", zap.Int64("deliveries", n))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -2,22 +2,38 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/princetheprogrammerbtw/nanoci/internal/artifact"
+	"github.com/princetheprogrammerbtw/nanoci/internal/cache"
 	"github.com/princetheprogrammerbtw/nanoci/internal/config"
 	"github.com/princetheprogrammerbtw/nanoci/internal/db"
+	"github.com/princetheprogrammerbtw/nanoci/internal/events"
+	"github.com/princetheprogrammerbtw/nanoci/internal/logstore"
+	"github.com/princetheprogrammerbtw/nanoci/internal/notify"
 	"github.com/princetheprogrammerbtw/nanoci/internal/queue"
 	"github.com/princetheprogrammerbtw/nanoci/internal/repository/postgres"
 	"github.com/princetheprogrammerbtw/nanoci/internal/runner"
+	"github.com/princetheprogrammerbtw/nanoci/internal/scm"
 	"github.com/princetheprogrammerbtw/nanoci/internal/worker"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 )
 
+const (
+	heartbeatInterval  = 10 * time.Second
+	heartbeatTTL       = 30 * time.Second
+	reapInterval       = 30 * time.Second
+	maxJobAttempts     = 3
+	notifyDrainTimeout = 30 * time.Second
+)
+
 func main() {
 	logger, _ := zap.NewProduction()
 	defer logger.Sync()
@@ -42,6 +58,9 @@ func main() {
 	buildRepo := postgres.NewBuildRepository(pool)
 	projectRepo := postgres.NewProjectRepository(pool)
 	secretRepo := postgres.NewSecretRepository(pool)
+	stepRepo := postgres.NewStepRepository(pool)
+	artifactRepo := postgres.NewArtifactRepository(pool)
+	notificationRepo := postgres.NewNotificationRepository(pool)
 
 	// Initialize Runner
 	dockerRunner, err := runner.NewDockerRunner()
@@ -54,37 +73,158 @@ func main() {
 	rdb := redis.NewClient(opt)
 	defer rdb.Close()
 
+	// Initialize Log Store
+	logStore, err := logstore.New(cfg)
+	if err != nil {
+		zap.L().Fatal("failed to initialize log store", zap.Error(err))
+	}
+
+	// Initialize Cache Store
+	cacheStore, err := cache.New(cfg)
+	if err != nil {
+		zap.L().Fatal("failed to initialize cache store", zap.Error(err))
+	}
+
+	// Initialize Artifact Store
+	artifactStore, err := artifact.New(cfg)
+	if err != nil {
+		zap.L().Fatal("failed to initialize artifact store", zap.Error(err))
+	}
+
+	// Initialize Queue
+	q := queue.NewRedisQueue(rdb)
+
+	// Initialize Event Bus
+	bus := events.NewRedisBus(rdb)
+
+	// Initialize SCM Providers, which also report commit statuses
+	providers, err := scm.NewRegistry(projectRepo, cfg)
+	if err != nil {
+		zap.L().Fatal("failed to initialize scm providers", zap.Error(err))
+	}
+
+	// Initialize Notifier
+	notifier := notify.NewNotifier(notificationRepo, buildRepo, projectRepo, cfg)
+
 	// Initialize Executor
-	executor := worker.NewExecutor(buildRepo, projectRepo, secretRepo, dockerRunner, rdb, cfg.EncryptionKey)
+	executor := worker.NewExecutor(buildRepo, projectRepo, secretRepo, stepRepo, artifactRepo, q, bus, dockerRunner, rdb, logStore, cacheStore, artifactStore, notifier, providers, cfg.EncryptionKey)
+
+	// Initialize Slots
+	slots, err := worker.NewPool(cfg.WorkerConcurrency)
+	if err != nil {
+		zap.L().Fatal("failed to initialize worker slots", zap.Error(err))
+	}
+	defer slots.Close()
 
-	zap.L().Info("worker started, waiting for jobs...")
+	// Builds run on their own context so that SIGTERM stops new work without
+	// cutting off builds that are already in flight.
+	buildCtx, cancelBuilds := context.WithCancelCause(context.Background())
+	defer cancelBuilds(nil)
 
-	for {
-		select {
-		case <-ctx.Done():
-			zap.L().Info("worker shutting down")
-			return
-		default:
-			result, err := rdb.BRPop(ctx, 5*time.Second, "nanoci:jobs").Result()
-			if err == redis.Nil {
-				continue
+	// Register with the queue and keep our heartbeat alive until the last
+	// in-flight build has drained.
+	workerID := newWorkerID()
+	if err := q.Heartbeat(ctx, workerID, heartbeatTTL); err != nil {
+		zap.L().Fatal("failed to register worker", zap.Error(err))
+	}
+	heartbeatCtx, stopHeartbeat := context.WithCancel(context.Background())
+	defer stopHeartbeat()
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-heartbeatCtx.Done():
+				return
+			case <-ticker.C:
+				if err := q.Heartbeat(heartbeatCtx, workerID, heartbeatTTL); err != nil {
+					zap.L().Error("failed to send heartbeat", zap.Error(err))
+				}
 			}
-			if err != nil {
-				zap.L().Error("failed to pop job from redis", zap.Error(err))
-				continue
+		}
+	}()
+
+	// Recover jobs from workers that died mid-build
+	reaper := worker.NewReaper(q, buildRepo, stepRepo, logStore, bus, providers, notifier, workerID, maxJobAttempts)
+	go reaper.Run(ctx, reapInterval)
+
+	// Stop builds that a user cancelled while they were running here
+	go func() {
+		for msg := range q.Control(heartbeatCtx) {
+			if msg.Action == queue.ActionCancel && executor.Cancel(msg.BuildID) {
+				zap.L().Info("cancelling build", zap.String("build_id", msg.BuildID))
 			}
+		}
+	}()
+
+	zap.L().Info("worker started, waiting for jobs...", zap.String("worker_id", workerID), zap.Int("concurrency", cfg.WorkerConcurrency))
+
+	run := func(slot *worker.Slot, d *queue.Delivery) {
+		log := zap.L().With(zap.String("build_id", d.Job.BuildID), zap.Int("slot", slot.ID))
+		log.Info("processing job")
+
+		if err := executor.Execute(buildCtx, d.Job.BuildID, slot.Workspace); err != nil {
+			log.Error("execution failed", zap.Error(err))
+		}
 
-			var job queue.Job
-			if err := json.Unmarshal([]byte(result[1]), &job); err != nil {
-				zap.L().Error("failed to unmarshal job", zap.Error(err))
-				continue
+		// A build cut off by shutdown goes back on the queue for another worker.
+		if errors.Is(context.Cause(buildCtx), worker.ErrWorkerShutdown) {
+			if err := reaper.Requeue(context.Background(), d); err != nil {
+				log.Error("failed to requeue job", zap.Error(err))
 			}
+			return
+		}
+		if err := q.Ack(context.Background(), d); err != nil {
+			log.Error("failed to ack job", zap.Error(err))
+		}
+	}
+
+	for {
+		slot, ok := slots.Acquire(ctx)
+		if !ok {
+			break
+		}
 
-			zap.L().Info("processing job", zap.String("build_id", job.BuildID))
-			
-			if err := executor.Execute(ctx, job.BuildID); err != nil {
-				zap.L().Error("execution failed", zap.String("build_id", job.BuildID), zap.Error(err))
+		d, err := q.Dequeue(ctx, workerID, 5*time.Second)
+		if d == nil || err != nil {
+			slots.Release(slot)
+		}
+		if err != nil {
+			if d != nil {
+				// Undecodable payloads can never succeed; drop them.
+				zap.L().Error("failed to decode job", zap.Error(err))
+				_ = q.Ack(context.Background(), d)
+			} else if ctx.Err() == nil {
+				zap.L().Error("failed to dequeue job", zap.Error(err))
 			}
+			continue
+		}
+		if d == nil {
+			continue
 		}
+
+		slots.Go(slot, func(slot *worker.Slot) { run(slot, d) })
+	}
+
+	zap.L().Info("worker shutting down, draining in-flight builds", zap.Duration("deadline", cfg.WorkerDrainTimeout))
+	if !slots.Wait(cfg.WorkerDrainTimeout) {
+		zap.L().Warn("drain deadline exceeded, cancelling remaining builds")
+		cancelBuilds(worker.ErrWorkerShutdown)
+		slots.Wait(heartbeatTTL)
+	}
+
+	notifier.Close(notifyDrainTimeout)
+	stopHeartbeat()
+	if err := q.Deregister(context.Background(), workerID); err != nil {
+		zap.L().Error("failed to deregister worker", zap.Error(err))
+	}
+	zap.L().Info("worker exited")
+}
+
+func newWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "worker"
 	}
+	return fmt.Sprintf("%s-%s", host, uuid.NewString()[:8])
 }
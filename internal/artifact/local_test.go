@@ -0,0 +1,70 @@
+package artifact
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalStoreDeduplicatesContents(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d1, size, err := store.Put(ctx, strings.NewReader("binary"))
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	d2, _, err := store.Put(ctx, strings.NewReader("binary"))
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if d1 != d2 || size != 6 {
+		t.Errorf("Expected identical digests and size 6, got %s, %s, %d", d1, d2, size)
+	}
+
+	f, err := store.Open(ctx, d1)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	b, _ := io.ReadAll(f)
+	f.Close()
+	if string(b) != "binary" {
+		t.Errorf("Expected stored contents, got %q", b)
+	}
+
+	if _, err := store.Open(ctx, "../../etc/passwd"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an invalid digest, got %v", err)
+	}
+}
+
+func TestLocalStoreDeleteSparesRecentContents(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, _, err := store.Put(ctx, strings.NewReader("report"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Delete(ctx, digest, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Open(ctx, digest); err != nil {
+		t.Errorf("Expected recently stored contents to survive, got %v", err)
+	}
+
+	if err := store.Delete(ctx, digest, time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Open(ctx, digest); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected contents to be deleted, got %v", err)
+	}
+}
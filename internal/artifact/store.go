@@ -0,0 +1,35 @@
+package artifact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/princetheprogrammerbtw/nanoci/internal/config"
+)
+
+var ErrNotFound = errors.New("artifact not found")
+
+// Store keeps artifact contents addressed by their SHA-256 digest, so a file
+// produced unchanged by many builds is stored once.
+type Store interface {
+	// Put stores the contents of r and returns their hex digest and size.
+	Put(ctx context.Context, r io.Reader) (digest string, size int64, err error)
+	Open(ctx context.Context, digest string) (io.ReadSeekCloser, error)
+	// Delete removes the contents of digest unless they were stored again at
+	// or after before, which keeps a sweep from removing contents a build is
+	// recording at the same time.
+	Delete(ctx context.Context, digest string, before time.Time) error
+}
+
+// New returns the Store selected by cfg.ArtifactStore.
+func New(cfg *config.Config) (Store, error) {
+	switch cfg.ArtifactStore {
+	case "", "local":
+		return NewLocalStore(cfg.ArtifactDir)
+	default:
+		return nil, fmt.Errorf("unknown artifact store: %s", cfg.ArtifactStore)
+	}
+}
@@ -0,0 +1,56 @@
+package artifact
+
+import (
+	"context"
+	"time"
+
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"go.uber.org/zap"
+)
+
+// sweepGrace spares contents stored shortly before a sweep: a build may have
+// stored them and be about to record an artifact that refers to them.
+const sweepGrace = time.Minute
+
+// Sweeper deletes expired artifacts along with contents no other artifact uses.
+type Sweeper struct {
+	repo  domain.ArtifactRepository
+	store Store
+}
+
+func NewSweeper(repo domain.ArtifactRepository, store Store) *Sweeper {
+	return &Sweeper{repo: repo, store: store}
+}
+
+// Run sweeps every interval until ctx is done.
+func (s *Sweeper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Sweep(ctx); err != nil && ctx.Err() == nil {
+			zap.L().Error("failed to sweep artifacts", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Sweeper) Sweep(ctx context.Context) error {
+	start := time.Now()
+	digests, err := s.repo.DeleteExpired(ctx, start)
+	if err != nil {
+		return err
+	}
+	for _, d := range digests {
+		if err := s.store.Delete(ctx, d, start.Add(-sweepGrace)); err != nil {
+			zap.L().Warn("failed to delete artifact contents", zap.String("digest", d), zap.Error(err))
+		}
+	}
+	if len(digests) > 0 {
+		zap.L().Info("swept expired artifacts", zap.Int("contents", len(digests)))
+	}
+	return nil
+}
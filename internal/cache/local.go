@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// LocalStore keeps entries as tarballs under <dir>/<project>/<key hash>.tar.gz.
+// Once the entries outgrow maxSize, the least recently used are evicted.
+type LocalStore struct {
+	dir     string
+	maxSize int64
+	mu      sync.Mutex
+}
+
+func NewLocalStore(dir string, maxSize int64) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalStore{dir: dir, maxSize: maxSize}, nil
+}
+
+func (s *LocalStore) Restore(ctx context.Context, project, key, dir string) (bool, error) {
+	path := s.path(project, key)
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	// The modification time doubles as the last use for LRU eviction
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil {
+		zap.L().Warn("failed to touch cache entry", zap.String("path", path), zap.Error(err))
+	}
+
+	if err := extract(ctx, f, dir); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *LocalStore) Save(ctx context.Context, project, key, dir string, paths []string) error {
+	path := s.path(project, key)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// Concurrent builds may save the same key; whichever renames last wins
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := archive(ctx, tmp, dir, paths); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return s.evict()
+}
+
+type entry struct {
+	path string
+	size int64
+	used time.Time
+}
+
+// evict removes the least recently used entries until the store fits in maxSize.
+func (s *LocalStore) evict() error {
+	if s.maxSize <= 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var entries []entry
+	var total int64
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Entries may disappear under us when several workers share the store
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".gz" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		entries = append(entries, entry{path: path, size: info.Size(), used: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].used.Before(entries[j].used) })
+	for _, e := range entries {
+		if total <= s.maxSize {
+			break
+		}
+		if err := os.Remove(e.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		zap.L().Info("evicted cache entry", zap.String("path", e.path), zap.Int64("size", e.size))
+		total -= e.size
+	}
+	return nil
+}
+
+func (s *LocalStore) path(project, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, url.PathEscape(project), hex.EncodeToString(sum[:])+".tar.gz")
+}
@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, ".cache/mod/a.txt"), "a")
+	writeFile(t, filepath.Join(src, ".cache/mod/sub/b.txt"), "b")
+	writeFile(t, filepath.Join(src, "main.go"), "package main")
+
+	if err := store.Save(ctx, "p1", "go-1", src, []string{".cache", "missing"}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	dst := t.TempDir()
+	found, err := store.Restore(ctx, "p1", "go-1", dst)
+	if err != nil || !found {
+		t.Fatalf("Expected entry to be restored, got %v, %v", found, err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(dst, ".cache/mod/sub/b.txt")); string(b) != "b" {
+		t.Errorf("Expected restored file, got %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "main.go")); !os.IsNotExist(err) {
+		t.Error("Expected only cache paths to be saved")
+	}
+
+	// Entries are scoped to their project
+	if found, _ := store.Restore(ctx, "p2", "go-1", t.TempDir()); found {
+		t.Error("Expected no entry for another project")
+	}
+}
+
+func TestLocalStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "deps/file"), "data")
+
+	// old and used were saved an hour ago, new a minute later
+	past := time.Now().Add(-time.Hour)
+	for i, key := range []string{"old", "used", "new"} {
+		if err := store.Save(ctx, "p", key, src, []string{"deps"}); err != nil {
+			t.Fatal(err)
+		}
+		at := past.Add(time.Duration(i/2) * time.Minute)
+		os.Chtimes(store.path("p", key), at, at)
+	}
+	if _, err := store.Restore(ctx, "p", "used", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Room for two entries
+	info, _ := os.Stat(store.path("p", "used"))
+	store.maxSize = 2 * info.Size()
+	if err := store.evict(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(store.path("p", "old")); !os.IsNotExist(err) {
+		t.Error("Expected least recently used entry to be evicted")
+	}
+	for _, key := range []string{"used", "new"} {
+		if _, err := os.Stat(store.path("p", key)); err != nil {
+			t.Errorf("Expected %s to be kept: %v", key, err)
+		}
+	}
+}
+
+func TestRestoreDoesNotWriteThroughSymlinks(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, ".cache/file"), "cached")
+	if err := store.Save(ctx, "p", "k", src, []string{".cache"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A checked-out repository could point the cache path elsewhere
+	outside := t.TempDir()
+	dst := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(dst, ".cache")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Restore(ctx, "p", "k", dst); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "file")); !os.IsNotExist(err) {
+		t.Error("Expected restore not to write outside the workspace")
+	}
+	if b, _ := os.ReadFile(filepath.Join(dst, ".cache/file")); string(b) != "cached" {
+		t.Errorf("Expected the symlink to be replaced, got %q", b)
+	}
+}
+
+func TestRenderKey(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "go.sum"), "v1")
+
+	first, err := RenderKey(`go-{{ checksum "go.sum" }}-{{ .Branch }}`, dir, KeyData{Branch: "main"})
+	if err != nil {
+		t.Fatalf("RenderKey failed: %v", err)
+	}
+	writeFile(t, filepath.Join(dir, "go.sum"), "v2")
+	second, _ := RenderKey(`go-{{ checksum "go.sum" }}-{{ .Branch }}`, dir, KeyData{Branch: "main"})
+	if first == second {
+		t.Error("Expected key to change with go.sum")
+	}
+
+	for _, tmpl := range []string{`{{ checksum "missing" }}`, `{{ checksum "../etc/passwd" }}`, `{{`} {
+		if _, err := RenderKey(tmpl, dir, KeyData{}); err == nil {
+			t.Errorf("Expected error for %s", tmpl)
+		}
+	}
+}
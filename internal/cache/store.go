@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/princetheprogrammerbtw/nanoci/internal/config"
+)
+
+// Store keeps cached directories between builds. Entries are scoped to a
+// project and addressed by the key rendered from the pipeline's cache
+// template. An entry is never overwritten: a key that changes whenever its
+// contents should, such as one including a lockfile checksum, gets a new entry.
+type Store interface {
+	// Restore unpacks the entry for key into dir, reporting whether there was one.
+	Restore(ctx context.Context, project, key, dir string) (bool, error)
+	// Save packs paths, relative to dir, into the entry for key unless it already exists.
+	Save(ctx context.Context, project, key, dir string, paths []string) error
+}
+
+// New returns the Store selected by cfg.CacheStore.
+func New(cfg *config.Config) (Store, error) {
+	switch cfg.CacheStore {
+	case "", "local":
+		return NewLocalStore(cfg.CacheDir, cfg.CacheMaxSizeMB<<20)
+	default:
+		return nil, fmt.Errorf("unknown cache store: %s", cfg.CacheStore)
+	}
+}
+
+// KeyData is what a key template can refer to, e.g. {{ .Branch }}.
+type KeyData struct {
+	Branch string
+}
+
+// RenderKey evaluates a cache key template such as
+// `go-{{ checksum "go.sum" }}`. checksum hashes one or more files of the
+// workspace, so the key changes whenever they do.
+func RenderKey(tmpl, workspace string, data KeyData) (string, error) {
+	t, err := template.New("key").Funcs(template.FuncMap{
+		"checksum": func(files ...string) (string, error) {
+			return checksum(workspace, files)
+		},
+	}).Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid cache key: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("invalid cache key: %w", err)
+	}
+	key := strings.TrimSpace(buf.String())
+	if key == "" {
+		return "", fmt.Errorf("cache key %q renders empty", tmpl)
+	}
+	return key, nil
+}
+
+func checksum(workspace string, files []string) (string, error) {
+	if len(files) == 0 {
+		return "", fmt.Errorf("checksum needs at least one file")
+	}
+	h := sha256.New()
+	for _, name := range files {
+		path, err := within(workspace, name)
+		if err != nil {
+			return "", err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// within resolves a relative path inside dir, refusing anything that would
+// escape it, whether through .. or through a symlink on the way.
+func within(dir, name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q is outside the workspace", name)
+	}
+
+	path := dir
+	parts := strings.Split(clean, string(filepath.Separator))
+	for i, part := range parts {
+		path = filepath.Join(path, part)
+		if i == len(parts)-1 {
+			break
+		}
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("path %q goes through a symlink", name)
+		}
+	}
+	return filepath.Join(dir, clean), nil
+}
@@ -0,0 +1,154 @@
+// Package checkout materialises the exact commit a build was triggered for.
+package checkout
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// deepenSteps are the history depths tried, in order, when the pushed commit
+// cannot be fetched directly. Zero means the full history.
+var deepenSteps = []int{50, 500, 0}
+
+type Options struct {
+	// Dir is the empty directory to check out into.
+	Dir     string
+	RepoURL string
+	// Ref is a branch name or a fully qualified ref such as refs/pull/1/head.
+	Ref string
+	// Commit is the SHA that must end up at HEAD. When empty the tip of Ref is used.
+	Commit string
+	// Credentials, if set, are used for every fetch.
+	Credentials *Credentials
+	// Output receives git's progress output.
+	Output io.Writer
+}
+
+// Checkout shallow-fetches Commit from Ref and detaches HEAD at it. It falls
+// back to progressively deeper fetches of Ref when the commit cannot be
+// fetched by SHA, and fails unless HEAD ends up at exactly Commit.
+func Checkout(ctx context.Context, opts Options) error {
+	env, cleanup, err := opts.Credentials.env()
+	if err != nil {
+		return fmt.Errorf("failed to prepare credentials: %w", err)
+	}
+	defer cleanup()
+
+	g := &git{dir: opts.Dir, env: env, out: opts.Output}
+	ref := qualify(opts.Ref)
+
+	if err := g.run(ctx, "init", "--quiet"); err != nil {
+		return err
+	}
+	if err := g.run(ctx, "remote", "add", "origin", opts.RepoURL); err != nil {
+		return err
+	}
+
+	if opts.Commit == "" {
+		if err := g.run(ctx, "fetch", "--depth=1", "origin", ref); err != nil {
+			return err
+		}
+		return g.run(ctx, "checkout", "--quiet", "--detach", "FETCH_HEAD")
+	}
+
+	if err := fetchCommit(ctx, g, ref, opts.Commit); err != nil {
+		return err
+	}
+	if err := g.run(ctx, "checkout", "--quiet", "--detach", opts.Commit); err != nil {
+		return err
+	}
+
+	head, err := g.output(ctx, "rev-parse", "HEAD")
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(head, strings.ToLower(opts.Commit)) {
+		return fmt.Errorf("checked out %s, expected %s", head, opts.Commit)
+	}
+	return nil
+}
+
+func fetchCommit(ctx context.Context, g *git, ref, commit string) error {
+	// Most servers allow fetching a reachable SHA directly; stay quiet if this one doesn't
+	if err := g.command(ctx, "fetch", "--quiet", "--depth=1", "origin", commit).Run(); err == nil && g.has(ctx, commit) {
+		return nil
+	}
+
+	for _, depth := range deepenSteps {
+		args := []string{"fetch", "origin", ref}
+		if depth > 0 {
+			args = append(args, fmt.Sprintf("--depth=%d", depth))
+		} else if g.shallow(ctx) {
+			args = append(args, "--unshallow")
+		}
+		if err := g.run(ctx, args...); err != nil {
+			return err
+		}
+		if g.has(ctx, commit) {
+			return nil
+		}
+	}
+	return fmt.Errorf("commit %s is not reachable from %s", commit, ref)
+}
+
+// qualify turns a bare branch name into a fully qualified ref.
+func qualify(ref string) string {
+	if ref == "" {
+		return "HEAD"
+	}
+	if strings.HasPrefix(ref, "refs/") {
+		return ref
+	}
+	return "refs/heads/" + ref
+}
+
+type git struct {
+	dir string
+	env []string
+	out io.Writer
+}
+
+func (g *git) run(ctx context.Context, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := g.command(ctx, args...)
+	cmd.Stdout = g.out
+	cmd.Stderr = &stderr
+	if g.out != nil {
+		cmd.Stderr = io.MultiWriter(&stderr, g.out)
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func (g *git) output(ctx context.Context, args ...string) (string, error) {
+	out, err := g.command(ctx, args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (g *git) has(ctx context.Context, commit string) bool {
+	return g.command(ctx, "cat-file", "-e", commit+"^{commit}").Run() == nil
+}
+
+func (g *git) shallow(ctx context.Context) bool {
+	out, err := g.output(ctx, "rev-parse", "--is-shallow-repository")
+	return err == nil && out == "true"
+}
+
+func (g *git) command(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = g.dir
+	// Never block on an interactive credential prompt
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	cmd.Env = append(cmd.Env, g.env...)
+	return cmd
+}
@@ -0,0 +1,126 @@
+package checkout
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newOrigin creates a repository with three commits on main and one on a
+// feature branch, returning its file:// URL and the commit SHAs.
+func newOrigin(t *testing.T) (string, map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	commit := func(name string) string {
+		if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", ".")
+		git("commit", "-q", "-m", name)
+		return git("rev-parse", "HEAD")
+	}
+
+	git("init", "-q", "-b", "main")
+	shas := map[string]string{}
+	shas["first"] = commit("first")
+	shas["second"] = commit("second")
+	git("checkout", "-q", "-b", "feature")
+	shas["feature"] = commit("feature")
+	git("checkout", "-q", "main")
+	shas["third"] = commit("third")
+
+	return "file://" + dir, shas
+}
+
+func TestCheckoutPinnedCommit(t *testing.T) {
+	url, shas := newOrigin(t)
+
+	tests := []struct {
+		name string
+		ref  string
+		sha  string
+		file string
+	}{
+		{"older commit on branch", "main", shas["second"], "second"},
+		{"feature branch", "feature", shas["feature"], "feature"},
+		{"abbreviated sha", "main", shas["first"][:10], "first"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := Checkout(context.Background(), Options{Dir: dir, RepoURL: url, Ref: tt.ref, Commit: tt.sha})
+			if err != nil {
+				t.Fatalf("Checkout failed: %v", err)
+			}
+			data, err := os.ReadFile(filepath.Join(dir, "file.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.file {
+				t.Errorf("Expected %q, got %q", tt.file, data)
+			}
+		})
+	}
+}
+
+func TestCheckoutBranchTip(t *testing.T) {
+	url, _ := newOrigin(t)
+	dir := t.TempDir()
+
+	if err := Checkout(context.Background(), Options{Dir: dir, RepoURL: url, Ref: "feature"}); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "file.txt"))
+	if string(data) != "feature" {
+		t.Errorf("Expected feature tip, got %q", data)
+	}
+}
+
+func TestCheckoutUnreachableCommit(t *testing.T) {
+	url, shas := newOrigin(t)
+	dir := t.TempDir()
+
+	// The feature commit is not reachable from main.
+	err := Checkout(context.Background(), Options{Dir: dir, RepoURL: url, Ref: "main", Commit: shas["feature"][:10]})
+	if err == nil {
+		t.Fatal("Expected checkout of unreachable commit to fail")
+	}
+}
+
+func TestCheckoutKeepsCredentialsOutOfGitConfig(t *testing.T) {
+	url, shas := newOrigin(t)
+	dir := t.TempDir()
+
+	creds := &Credentials{Token: "ghp_supersecrettoken"}
+	err := Checkout(context.Background(), Options{Dir: dir, RepoURL: url, Ref: "main", Commit: shas["third"], Credentials: creds})
+	if err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+
+	config, err := os.ReadFile(filepath.Join(dir, ".git", "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range creds.Secrets() {
+		if strings.Contains(string(config), secret) {
+			t.Errorf(".git/config contains credential %q", secret)
+		}
+	}
+}
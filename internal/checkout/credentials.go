@@ -0,0 +1,84 @@
+package checkout
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Credentials authenticate the fetch of a private repository. They are
+// handed to git through the environment only, so nothing is persisted in the
+// workspace's .git/config.
+type Credentials struct {
+	// Token is an HTTPS access token, e.g. a GitHub personal access token.
+	Token string
+	// SSHKey is a PEM encoded private deploy key.
+	SSHKey string
+}
+
+// Secrets returns the values that must never appear in build logs.
+func (c *Credentials) Secrets() []string {
+	if c == nil {
+		return nil
+	}
+
+	var secrets []string
+	if c.Token != "" {
+		secrets = append(secrets, c.Token, basicAuth(c.Token))
+	}
+	for _, line := range strings.Split(c.SSHKey, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) >= 16 && !strings.HasPrefix(line, "-----") {
+			secrets = append(secrets, line)
+		}
+	}
+	return secrets
+}
+
+// env returns the environment that makes git use the credentials. Files it
+// needs are written to a private directory outside the workspace, which the
+// returned cleanup removes.
+func (c *Credentials) env() ([]string, func(), error) {
+	noop := func() {}
+	if c == nil {
+		return nil, noop, nil
+	}
+
+	var env []string
+	cleanup := noop
+
+	if c.Token != "" {
+		env = append(env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+basicAuth(c.Token),
+		)
+	}
+
+	if c.SSHKey != "" {
+		dir, err := os.MkdirTemp("", "nanoci-ssh-*")
+		if err != nil {
+			return nil, noop, err
+		}
+		cleanup = func() { os.RemoveAll(dir) }
+
+		keyFile := filepath.Join(dir, "id")
+		key := strings.TrimSpace(c.SSHKey) + "\n"
+		if err := os.WriteFile(keyFile, []byte(key), 0o600); err != nil {
+			cleanup()
+			return nil, noop, err
+		}
+		env = append(env, fmt.Sprintf(
+			"GIT_SSH_COMMAND=ssh -i %s -o IdentitiesOnly=yes -o StrictHostKeyChecking=accept-new -o UserKnownHostsFile=%s",
+			keyFile, filepath.Join(dir, "known_hosts"),
+		))
+	}
+
+	return env, cleanup, nil
+}
+
+func basicAuth(token string) string {
+	return base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token))
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -12,11 +13,53 @@ type Config struct {
 	RedisURL       string `mapstructure:"REDIS_URL"`
 	GithubClientID string `mapstructure:"GITHUB_CLIENT_ID"`
 	GithubSecret   string `mapstructure:"GITHUB_CLIENT_SECRET"`
+	GithubAPIURL   string `mapstructure:"GITHUB_API_URL"`
+	GithubAppID    int64  `mapstructure:"GITHUB_APP_ID"`
+	GithubAppKey   string `mapstructure:"GITHUB_APP_PRIVATE_KEY"`
+	GitlabURL      string `mapstructure:"GITLAB_URL"`
+	GiteaURL       string `mapstructure:"GITEA_URL"`
 	EncryptionKey  string `mapstructure:"ENCRYPTION_KEY"`
+	LogStore       string `mapstructure:"LOG_STORE"`
+	LogDir         string `mapstructure:"LOG_DIR"`
+	CacheStore     string `mapstructure:"CACHE_STORE"`
+	CacheDir       string `mapstructure:"CACHE_DIR"`
+	CacheMaxSizeMB int64  `mapstructure:"CACHE_MAX_SIZE_MB"`
+	ArtifactStore  string `mapstructure:"ARTIFACT_STORE"`
+	ArtifactDir    string `mapstructure:"ARTIFACT_DIR"`
+	PublicURL      string `mapstructure:"PUBLIC_URL"`
+
+	SMTPHost     string `mapstructure:"SMTP_HOST"`
+	SMTPPort     int    `mapstructure:"SMTP_PORT"`
+	SMTPUsername string `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword string `mapstructure:"SMTP_PASSWORD"`
+	SMTPFrom     string `mapstructure:"SMTP_FROM"`
+
+	WorkerConcurrency  int           `mapstructure:"WORKER_CONCURRENCY"`
+	WorkerDrainTimeout time.Duration `mapstructure:"WORKER_DRAIN_TIMEOUT"`
 }
 
 func Load() (*Config, error) {
 	viper.SetDefault("PORT", "8080")
+	viper.SetDefault("GITHUB_API_URL", "https://api.github.com")
+	viper.SetDefault("GITHUB_APP_ID", 0)
+	viper.SetDefault("GITHUB_APP_PRIVATE_KEY", "")
+	viper.SetDefault("GITLAB_URL", "https://gitlab.com")
+	viper.SetDefault("GITEA_URL", "")
+	viper.SetDefault("LOG_STORE", "local")
+	viper.SetDefault("LOG_DIR", "/var/lib/nanoci/logs")
+	viper.SetDefault("CACHE_STORE", "local")
+	viper.SetDefault("CACHE_DIR", "/var/lib/nanoci/cache")
+	viper.SetDefault("CACHE_MAX_SIZE_MB", 10240)
+	viper.SetDefault("ARTIFACT_STORE", "local")
+	viper.SetDefault("ARTIFACT_DIR", "/var/lib/nanoci/artifacts")
+	viper.SetDefault("PUBLIC_URL", "http://localhost:5173")
+	viper.SetDefault("SMTP_HOST", "")
+	viper.SetDefault("SMTP_PORT", 587)
+	viper.SetDefault("SMTP_USERNAME", "")
+	viper.SetDefault("SMTP_PASSWORD", "")
+	viper.SetDefault("SMTP_FROM", "nanoci@localhost")
+	viper.SetDefault("WORKER_CONCURRENCY", 1)
+	viper.SetDefault("WORKER_DRAIN_TIMEOUT", "10m")
 	viper.AutomaticEnv()
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 
@@ -0,0 +1,222 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Matrix fans a pipeline out over every combination of its axes. Each axis
+// is a variable name with the values it takes; exclude drops combinations
+// and include adds extra ones.
+//
+//	matrix:
+//	  GO_VERSION: ["1.21", "1.22"]
+//	  POSTGRES: ["15", "16"]
+//	  exclude:
+//	    - {GO_VERSION: "1.21", POSTGRES: "16"}
+type Matrix struct {
+	Axes    map[string][]string
+	Exclude []map[string]string
+	Include []map[string]string
+}
+
+// axisName is what a matrix axis must be called, as it becomes an env var.
+// It also catches misspelt keywords such as exlude.
+var axisName = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
+
+func (m *Matrix) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: matrix must be a mapping", value.Line)
+	}
+	m.Axes = make(map[string][]string)
+	for i := 0; i < len(value.Content); i += 2 {
+		key, val := value.Content[i], value.Content[i+1]
+		var err error
+		switch key.Value {
+		case "exclude":
+			err = val.Decode(&m.Exclude)
+		case "include":
+			err = val.Decode(&m.Include)
+		default:
+			if !axisName.MatchString(key.Value) {
+				return fmt.Errorf("line %d: matrix axis %q must be an upper-case env var name", key.Line, key.Value)
+			}
+			var values []string
+			err = val.Decode(&values)
+			if err == nil && len(values) == 0 {
+				err = fmt.Errorf("line %d: matrix axis %q has no values", key.Line, key.Value)
+			}
+			m.Axes[key.Value] = values
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Combinations lists the variable sets the matrix expands into, in a stable order.
+func (m *Matrix) Combinations() []map[string]string {
+	if m == nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(m.Axes))
+	for name := range m.Axes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var combos []map[string]string
+	if len(names) > 0 {
+		combos = []map[string]string{{}}
+		for _, name := range names {
+			var next []map[string]string
+			for _, c := range combos {
+				for _, v := range m.Axes[name] {
+					n := make(map[string]string, len(c)+1)
+					for k, cv := range c {
+						n[k] = cv
+					}
+					n[name] = v
+					next = append(next, n)
+				}
+			}
+			combos = next
+		}
+	}
+
+	var kept []map[string]string
+	for _, c := range combos {
+		if !matchesAny(m.Exclude, c) {
+			kept = append(kept, c)
+		}
+	}
+	for _, c := range m.Include {
+		if !containsCombination(kept, c) {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// matchesAny reports whether c has every value of at least one of the partial sets.
+func matchesAny(sets []map[string]string, c map[string]string) bool {
+	for _, set := range sets {
+		match := true
+		for k, v := range set {
+			if c[k] != v {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+func containsCombination(combos []map[string]string, c map[string]string) bool {
+	for _, other := range combos {
+		if len(other) == len(c) && matchesAny([]map[string]string{c}, other) {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyMatrix prepares the pipeline for one matrix combination: the values
+// are substituted for ${VAR} references in images and the cache key, and
+// added to the env of every step, where a step's own env takes precedence.
+func (p *Pipeline) ApplyMatrix(vars map[string]string) {
+	expand := func(s string) string {
+		return os.Expand(s, func(name string) string {
+			if v, ok := vars[name]; ok {
+				return v
+			}
+			return "${" + name + "}"
+		})
+	}
+
+	p.Image = expand(p.Image)
+	if p.Cache != nil {
+		p.Cache.Key = expand(p.Cache.Key)
+	}
+	for i := range p.Services {
+		p.Services[i].Image = expand(p.Services[i].Image)
+	}
+	for i := range p.Steps {
+		step := &p.Steps[i]
+		step.Image = expand(step.Image)
+		env := make(map[string]string, len(vars)+len(step.Env))
+		for k, v := range vars {
+			env[k] = v
+		}
+		for k, v := range step.Env {
+			env[k] = v
+		}
+		step.Env = env
+	}
+}
+
+// RollUp derives the status of a matrix build from its children. It reports
+// false while any child has yet to finish. A parent succeeds only if every
+// child did; otherwise failures outrank timeouts, which outrank cancellations.
+func RollUp(children []*Build) (BuildStatus, bool) {
+	rank := map[BuildStatus]int{
+		BuildStatusSuccess:   0,
+		BuildStatusCancelled: 1,
+		BuildStatusTimedOut:  2,
+		BuildStatusFailed:    3,
+	}
+	status := BuildStatusSuccess
+	for _, c := range children {
+		r, final := rank[c.Status]
+		if !final {
+			return "", false
+		}
+		if r > rank[status] {
+			status = c.Status
+		}
+	}
+	return status, true
+}
+
+// FinishParent records the rolled-up status on the parent of a matrix child
+// once the last of its siblings has finished, and returns the parent it
+// finished. It does nothing for builds without a parent. When the last
+// siblings finish together, only the first to finish the parent returns it,
+// so the parent's result is reported once.
+func FinishParent(ctx context.Context, repo BuildRepository, child *Build) (*Build, error) {
+	if child.ParentID == nil {
+		return nil, nil
+	}
+	children, err := repo.ListByParentID(ctx, *child.ParentID)
+	if err != nil {
+		return nil, err
+	}
+	status, done := RollUp(children)
+	if !done {
+		return nil, nil
+	}
+
+	parent, err := repo.GetByID(ctx, *child.ParentID)
+	if err != nil || parent == nil {
+		return nil, err
+	}
+	finishTime := time.Now()
+	parent.Status = status
+	parent.FinishedAt = &finishTime
+	ok, err := repo.UpdateStatus(ctx, parent, BuildStatusRunning)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return parent, nil
+}
@@ -0,0 +1,120 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestMatrixCombinations(t *testing.T) {
+	src := `
+image: golang:${GO_VERSION}
+matrix:
+  GO_VERSION: ["1.21", "1.22"]
+  POSTGRES: ["15", "16"]
+  exclude:
+    - {GO_VERSION: "1.21", POSTGRES: "16"}
+  include:
+    - {GO_VERSION: "1.23", POSTGRES: "16"}
+    - {GO_VERSION: "1.22", POSTGRES: "15"}
+steps:
+  - name: test
+    commands: [go test ./...]
+    env:
+      POSTGRES: override
+`
+	p, err := ParsePipeline([]byte(src))
+	if err != nil {
+		t.Fatalf("ParsePipeline failed: %v", err)
+	}
+
+	combos := p.Matrix.Combinations()
+	want := "[map[GO_VERSION:1.21 POSTGRES:15] map[GO_VERSION:1.22 POSTGRES:15] map[GO_VERSION:1.22 POSTGRES:16] map[GO_VERSION:1.23 POSTGRES:16]]"
+	if fmt.Sprint(combos) != want {
+		t.Fatalf("Expected %s, got %v", want, combos)
+	}
+
+	p.ApplyMatrix(combos[3])
+	if p.Image != "golang:1.23" {
+		t.Errorf("Expected image golang:1.23, got %s", p.Image)
+	}
+	env := p.Steps[0].Env
+	if env["GO_VERSION"] != "1.23" || env["POSTGRES"] != "override" {
+		t.Errorf("Unexpected step env: %v", env)
+	}
+}
+
+func TestMatrixRejectsInvalidAxisNames(t *testing.T) {
+	for _, axis := range []string{"exlude", "go-version", "1GO"} {
+		src := "matrix:\n  GO_VERSION: [\"1.22\"]\n  " + axis + ": [\"x\"]\nsteps:\n  - name: test\n    commands: [\"true\"]\n"
+		if _, err := ParsePipeline([]byte(src)); err == nil {
+			t.Errorf("Expected matrix axis %q to be rejected", axis)
+		}
+	}
+}
+
+func TestRollUp(t *testing.T) {
+	children := func(statuses ...BuildStatus) []*Build {
+		var builds []*Build
+		for _, s := range statuses {
+			builds = append(builds, &Build{Status: s})
+		}
+		return builds
+	}
+
+	if _, done := RollUp(children(BuildStatusSuccess, BuildStatusRunning)); done {
+		t.Error("Expected roll-up to wait for running children")
+	}
+	if s, _ := RollUp(children(BuildStatusSuccess, BuildStatusSuccess)); s != BuildStatusSuccess {
+		t.Errorf("Expected SUCCESS, got %s", s)
+	}
+	if s, _ := RollUp(children(BuildStatusCancelled, BuildStatusFailed, BuildStatusTimedOut)); s != BuildStatusFailed {
+		t.Errorf("Expected FAILED, got %s", s)
+	}
+}
+
+// fakeBuildRepo holds one matrix parent and its children.
+type fakeBuildRepo struct {
+	BuildRepository
+	parent   Build
+	children []*Build
+}
+
+func (r *fakeBuildRepo) ListByParentID(ctx context.Context, parentID uuid.UUID) ([]*Build, error) {
+	return r.children, nil
+}
+
+func (r *fakeBuildRepo) GetByID(ctx context.Context, id uuid.UUID) (*Build, error) {
+	b := r.parent
+	return &b, nil
+}
+
+func (r *fakeBuildRepo) UpdateStatus(ctx context.Context, b *Build, from BuildStatus) (bool, error) {
+	if r.parent.Status != from {
+		return false, nil
+	}
+	r.parent = *b
+	return true, nil
+}
+
+func TestFinishParentOnce(t *testing.T) {
+	parentID := uuid.New()
+	repo := &fakeBuildRepo{
+		parent: Build{ID: parentID, Status: BuildStatusRunning},
+		children: []*Build{
+			{ParentID: &parentID, Status: BuildStatusSuccess},
+			{ParentID: &parentID, Status: BuildStatusFailed},
+		},
+	}
+
+	// Both children finished together and each tries to finish the parent
+	first, err := FinishParent(context.Background(), repo, repo.children[0])
+	if err != nil || first == nil || first.Status != BuildStatusFailed {
+		t.Fatalf("Expected the first child to finish the parent as FAILED, got %+v, %v", first, err)
+	}
+	if second, err := FinishParent(context.Background(), repo, repo.children[1]); err != nil || second != nil {
+		t.Errorf("Expected the second child to leave the parent alone, got %+v, %v", second, err)
+	}
+}
@@ -2,6 +2,7 @@ package domain
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -23,23 +24,54 @@ type UserRepository interface {
 	GetByID(ctx context.Context, id uuid.UUID) (*User, error)
 }
 
+// CredentialType says how the worker authenticates when cloning a project.
+type CredentialType string
+
+const (
+	CredentialTypeNone   CredentialType = ""
+	CredentialTypeToken  CredentialType = "token"
+	CredentialTypeSSHKey CredentialType = "ssh_key"
+)
+
+// SCMProvider is the source code host a project's repository lives on.
+type SCMProvider string
+
+const (
+	SCMProviderGitHub SCMProvider = "github"
+	SCMProviderGitLab SCMProvider = "gitlab"
+	SCMProviderGitea  SCMProvider = "gitea"
+)
+
+func (p SCMProvider) Valid() bool {
+	switch p {
+	case SCMProviderGitHub, SCMProviderGitLab, SCMProviderGitea:
+		return true
+	}
+	return false
+}
+
 type Project struct {
-	ID            uuid.UUID `json:"id"`
-	UserID        uuid.UUID `json:"user_id"`
-	Name          string    `json:"name"`
-	RepoURL       string    `json:"repo_url"`
-	GithubRepoID  string    `json:"github_repo_id"`
-	DefaultBranch string    `json:"default_branch"`
-	WebhookSecret string    `json:"-"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID                  uuid.UUID      `json:"id"`
+	UserID              uuid.UUID      `json:"user_id"`
+	Name                string         `json:"name"`
+	RepoURL             string         `json:"repo_url"`
+	Provider            SCMProvider    `json:"provider"`
+	RepoID              string         `json:"repo_id"` // The provider's ID for the repository
+	DefaultBranch       string         `json:"default_branch"`
+	WebhookSecret       string         `json:"-"`
+	CredentialType      CredentialType `json:"credential_type"`
+	EncryptedCredential string         `json:"-"`
+	CreatedAt           time.Time      `json:"created_at"`
+	UpdatedAt           time.Time      `json:"updated_at"`
 }
 
 type ProjectRepository interface {
 	Create(ctx context.Context, project *Project) error
 	GetByID(ctx context.Context, id uuid.UUID) (*Project, error)
-	GetByGithubRepoID(ctx context.Context, githubRepoID string) (*Project, error)
+	GetByRepoID(ctx context.Context, provider SCMProvider, repoID string) (*Project, error)
 	ListByUserID(ctx context.Context, userID uuid.UUID) ([]*Project, error)
+	UpdateCredential(ctx context.Context, project *Project) error
+	UpdateWebhookSecret(ctx context.Context, project *Project) error
 }
 
 type Secret struct {
@@ -64,23 +96,259 @@ const (
 	BuildStatusSuccess   BuildStatus = "SUCCESS"
 	BuildStatusFailed    BuildStatus = "FAILED"
 	BuildStatusCancelled BuildStatus = "CANCELLED"
+	BuildStatusTimedOut  BuildStatus = "TIMED_OUT"
 )
 
+// Finished reports whether s is a final status, which a build never leaves.
+func (s BuildStatus) Finished() bool {
+	switch s {
+	case BuildStatusSuccess, BuildStatusFailed, BuildStatusCancelled, BuildStatusTimedOut:
+		return true
+	}
+	return false
+}
+
+// BuildEvent is what triggered a build.
+type BuildEvent string
+
+const (
+	BuildEventPush        BuildEvent = "push"
+	BuildEventPullRequest BuildEvent = "pull_request"
+	BuildEventTag         BuildEvent = "tag"
+	BuildEventManual      BuildEvent = "manual"
+)
+
+// Build is one run of a project's pipeline. A pipeline with a matrix runs
+// as a parent build whose children each carry one combination in Matrix.
+// Pull request builds record the PR in PRNumber and its head branch in
+// SourceBranch, while Branch is the branch it targets; Fork is set when the
+// head lives in another repository, and such builds get no secrets.
+// CheckoutRef is the ref the provider serves the PR's head commit under. Tag
+// builds carry the pushed tag in Tag and have no branch. CancelRequested is
+// set when a running build is cancelled, for whichever worker runs or
+// recovers it.
 type Build struct {
-	ID            uuid.UUID   `json:"id"`
-	ProjectID     uuid.UUID   `json:"project_id"`
-	CommitHash    string      `json:"commit_hash"`
-	CommitMessage string      `json:"commit_message"`
-	Branch        string      `json:"branch"`
-	Status        BuildStatus `json:"status"`
-	StartedAt     *time.Time  `json:"started_at"`
-	FinishedAt    *time.Time  `json:"finished_at"`
-	CreatedAt     time.Time   `json:"created_at"`
+	ID              uuid.UUID         `json:"id"`
+	ProjectID       uuid.UUID         `json:"project_id"`
+	CommitHash      string            `json:"commit_hash"`
+	CommitMessage   string            `json:"commit_message"`
+	Branch          string            `json:"branch"`
+	Tag             string            `json:"tag,omitempty"`
+	Event           BuildEvent        `json:"event"`
+	ChangedFiles    []string          `json:"changed_files"`
+	PRNumber        *int              `json:"pr_number,omitempty"`
+	SourceBranch    string            `json:"source_branch,omitempty"`
+	CheckoutRef     string            `json:"checkout_ref,omitempty"`
+	Fork            bool              `json:"fork"`
+	ParentID        *uuid.UUID        `json:"parent_id,omitempty"`
+	Matrix          map[string]string `json:"matrix,omitempty"`
+	Status          BuildStatus       `json:"status"`
+	CancelRequested bool              `json:"cancel_requested"`
+	StartedAt       *time.Time        `json:"started_at"`
+	FinishedAt      *time.Time        `json:"finished_at"`
+	CreatedAt       time.Time         `json:"created_at"`
+}
+
+// Ref returns the git ref the build's commit is fetched from. Pull request
+// builds recorded before providers supplied CheckoutRef fall back to
+// GitHub's layout.
+func (b *Build) Ref() string {
+	switch {
+	case b.CheckoutRef != "":
+		return b.CheckoutRef
+	case b.PRNumber != nil:
+		return fmt.Sprintf("refs/pull/%d/head", *b.PRNumber)
+	case b.Tag != "":
+		return "refs/tags/" + b.Tag
+	}
+	return b.Branch
 }
 
 type BuildRepository interface {
 	Create(ctx context.Context, build *Build) error
 	Update(ctx context.Context, build *Build) error
+	// UpdateStatus records build's status and times only if its stored
+	// status is still from, and reports whether it was.
+	UpdateStatus(ctx context.Context, build *Build, from BuildStatus) (bool, error)
+	// RequestCancel flags a build to be cancelled by the worker running it,
+	// or by the reaper if that worker is gone.
+	RequestCancel(ctx context.Context, id uuid.UUID) error
 	GetByID(ctx context.Context, id uuid.UUID) (*Build, error)
 	ListByProjectID(ctx context.Context, projectID uuid.UUID) ([]*Build, error)
+	ListByParentID(ctx context.Context, parentID uuid.UUID) ([]*Build, error)
+	// GetPrevious returns the last top-level build of the same project,
+	// branch, event and pull request created before build that ran to a
+	// result, or nil.
+	GetPrevious(ctx context.Context, build *Build) (*Build, error)
+}
+
+type StepStatus string
+
+const (
+	StepStatusPending   StepStatus = "PENDING"
+	StepStatusRunning   StepStatus = "RUNNING"
+	StepStatusSuccess   StepStatus = "SUCCESS"
+	StepStatusFailed    StepStatus = "FAILED"
+	StepStatusSkipped   StepStatus = "SKIPPED"
+	StepStatusCancelled StepStatus = "CANCELLED"
+	StepStatusTimedOut  StepStatus = "TIMED_OUT"
+)
+
+// BuildStep is the recorded execution of a single pipeline Step within a build.
+type BuildStep struct {
+	ID         uuid.UUID  `json:"id"`
+	BuildID    uuid.UUID  `json:"build_id"`
+	Name       string     `json:"name"`
+	Position   int        `json:"position"`
+	Status     StepStatus `json:"status"`
+	ExitCode   *int       `json:"exit_code"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+type StepRepository interface {
+	Create(ctx context.Context, step *BuildStep) error
+	Update(ctx context.Context, step *BuildStep) error
+	ListByBuildID(ctx context.Context, buildID uuid.UUID) ([]*BuildStep, error)
+	DeleteByBuildID(ctx context.Context, buildID uuid.UUID) error
+}
+
+// Artifact is a file a build produced, kept in the artifact store under its
+// SHA-256 digest until it expires.
+type Artifact struct {
+	ID        uuid.UUID `json:"id"`
+	BuildID   uuid.UUID `json:"build_id"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	Digest    string    `json:"digest"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ArtifactRepository interface {
+	Create(ctx context.Context, artifact *Artifact) error
+	GetByID(ctx context.Context, id uuid.UUID) (*Artifact, error)
+	ListByBuildID(ctx context.Context, buildID uuid.UUID) ([]*Artifact, error)
+	// DeleteExpired removes artifacts that expired before t and returns the
+	// digests no remaining artifact refers to.
+	DeleteExpired(ctx context.Context, t time.Time) ([]string, error)
+}
+
+// NotificationKind is where a notification target delivers to.
+type NotificationKind string
+
+const (
+	// NotificationKindWebhook posts the build as JSON to any URL.
+	NotificationKindWebhook NotificationKind = "webhook"
+	// NotificationKindSlack posts a text message to a Slack-compatible
+	// incoming webhook, which Mattermost and Teams also accept.
+	NotificationKindSlack NotificationKind = "slack"
+	// NotificationKindEmail mails the recipients through the configured SMTP server.
+	NotificationKindEmail NotificationKind = "email"
+)
+
+// NotifyOn selects which finished builds a target hears about.
+type NotifyOn string
+
+const (
+	NotifyAlways  NotifyOn = "always"
+	NotifyFailure NotifyOn = "failure"
+	NotifyChange  NotifyOn = "change"
+)
+
+// NotificationTarget is somewhere a project's build results are sent. HTTP
+// deliveries are signed with the target's secret, which is encrypted at rest.
+type NotificationTarget struct {
+	ID              uuid.UUID        `json:"id"`
+	ProjectID       uuid.UUID        `json:"project_id"`
+	Kind            NotificationKind `json:"kind"`
+	URL             string           `json:"url,omitempty"`
+	Recipients      []string         `json:"recipients,omitempty"`
+	On              NotifyOn         `json:"on"`
+	Branches        []string         `json:"branches"`
+	PullRequests    bool             `json:"pull_requests"`
+	EncryptedSecret string           `json:"-"`
+	CreatedAt       time.Time        `json:"created_at"`
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryStatusPending   DeliveryStatus = "PENDING"
+	DeliveryStatusDelivered DeliveryStatus = "DELIVERED"
+	DeliveryStatusFailed    DeliveryStatus = "FAILED"
+)
+
+// NotificationDelivery records sending one build result to one target.
+type NotificationDelivery struct {
+	ID           uuid.UUID      `json:"id"`
+	TargetID     uuid.UUID      `json:"target_id"`
+	BuildID      uuid.UUID      `json:"build_id"`
+	Status       DeliveryStatus `json:"status"`
+	Attempts     int            `json:"attempts"`
+	ResponseCode *int           `json:"response_code"`
+	Error        string         `json:"error,omitempty"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+}
+
+type NotificationRepository interface {
+	CreateTarget(ctx context.Context, target *NotificationTarget) error
+	ListTargetsByProjectID(ctx context.Context, projectID uuid.UUID) ([]*NotificationTarget, error)
+	DeleteTarget(ctx context.Context, projectID, id uuid.UUID) error
+	CreateDelivery(ctx context.Context, delivery *NotificationDelivery) error
+	UpdateDelivery(ctx context.Context, delivery *NotificationDelivery) error
+	// ListDeliveriesByProjectID returns the project's most recent deliveries, newest first.
+	ListDeliveriesByProjectID(ctx context.Context, projectID uuid.UUID, limit int) ([]*NotificationDelivery, error)
+}
+
+// WebhookOutcome is what came of a webhook delivery.
+type WebhookOutcome string
+
+const (
+	// WebhookOutcomePending is recorded while the delivery is evaluated.
+	WebhookOutcomePending WebhookOutcome = "pending"
+	// WebhookOutcomeTriggered deliveries created a build.
+	WebhookOutcomeTriggered WebhookOutcome = "triggered"
+	// WebhookOutcomeIgnored deliveries were of events or actions we don't build.
+	WebhookOutcomeIgnored WebhookOutcome = "ignored"
+	// WebhookOutcomeInvalid deliveries had a payload that could not be parsed.
+	WebhookOutcomeInvalid WebhookOutcome = "invalid"
+	// WebhookOutcomeFailed deliveries would have built but the build could not be created.
+	WebhookOutcomeFailed WebhookOutcome = "failed"
+)
+
+// WebhookDelivery records a verified webhook received for a project, or a
+// redelivery of one, keeping the payload so it can be evaluated again.
+type WebhookDelivery struct {
+	ID           uuid.UUID      `json:"id"`
+	ProjectID    uuid.UUID      `json:"project_id"`
+	DeliveryID   string         `json:"delivery_id"` // The provider's ID, e.g. X-GitHub-Delivery; empty for redeliveries
+	Event        string         `json:"event"`
+	PayloadHash  string         `json:"payload_hash"` // Hex SHA-256 of the payload
+	Payload      []byte         `json:"-"`
+	Outcome      WebhookOutcome `json:"outcome"`
+	Error        string         `json:"error,omitempty"`
+	BuildID      *uuid.UUID     `json:"build_id,omitempty"`
+	RedeliveryOf *uuid.UUID     `json:"redelivery_of,omitempty"`
+	CreatedAt    time.Time      `json:"created_at"`
+}
+
+type WebhookDeliveryRepository interface {
+	// Create records a delivery. It reports false and records nothing if the
+	// project already has a delivery with the same non-empty DeliveryID.
+	Create(ctx context.Context, delivery *WebhookDelivery) (bool, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*WebhookDelivery, error)
+	GetByDeliveryID(ctx context.Context, projectID uuid.UUID, deliveryID string) (*WebhookDelivery, error)
+	// Retry claims a recorded delivery to be evaluated again and marks it
+	// pending. It reports false unless the delivery failed, or has been
+	// pending for longer than lease because its evaluation was cut short.
+	Retry(ctx context.Context, id uuid.UUID, lease time.Duration) (bool, error)
+	UpdateOutcome(ctx context.Context, delivery *WebhookDelivery) error
+	// ListByProjectID returns the project's most recent deliveries, newest
+	// first, without their payloads.
+	ListByProjectID(ctx context.Context, projectID uuid.UUID, limit int) ([]*WebhookDelivery, error)
+	// DeleteOlderThan removes deliveries received before t and reports how
+	// many it removed.
+	DeleteOlderThan(ctx context.Context, t time.Time) (int64, error)
 }
@@ -0,0 +1,71 @@
+package domain
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+)
+
+// Validate checks that the target can be delivered to, filling in the
+// default filter.
+func (t *NotificationTarget) Validate() error {
+	switch t.Kind {
+	case NotificationKindWebhook, NotificationKindSlack:
+		u, err := url.Parse(t.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("url must be an http or https URL")
+		}
+		t.Recipients = nil
+	case NotificationKindEmail:
+		if len(t.Recipients) == 0 {
+			return fmt.Errorf("email targets need at least one recipient")
+		}
+		for _, r := range t.Recipients {
+			if _, err := mail.ParseAddress(r); err != nil {
+				return fmt.Errorf("invalid recipient %q", r)
+			}
+		}
+		t.URL = ""
+	default:
+		return fmt.Errorf("kind must be webhook, slack or email")
+	}
+
+	switch t.On {
+	case "":
+		t.On = NotifyAlways
+	case NotifyAlways, NotifyFailure, NotifyChange:
+	default:
+		return fmt.Errorf("on must be always, failure or change")
+	}
+	if t.Branches == nil {
+		t.Branches = []string{}
+	}
+	return validatePatterns(t.Branches)
+}
+
+// Wants reports whether the target should hear about build, which has just
+// finished. previous is the build before it on the same branch, if any, and
+// is only consulted for NotifyChange. Cancelled builds only reach targets
+// that want every result. Pull request builds carry the branch they target,
+// so targets filtering on branches only hear about them if they opt in.
+func (t *NotificationTarget) Wants(build, previous *Build) bool {
+	if len(t.Branches) > 0 {
+		if build.Event == BuildEventPullRequest && !t.PullRequests {
+			return false
+		}
+		if !MatchAny(t.Branches, build.Branch) {
+			return false
+		}
+	}
+	switch t.On {
+	case NotifyFailure:
+		return build.Status == BuildStatusFailed || build.Status == BuildStatusTimedOut
+	case NotifyChange:
+		if build.Status == BuildStatusCancelled {
+			return false
+		}
+		return previous == nil || previous.Status != build.Status
+	default:
+		return true
+	}
+}
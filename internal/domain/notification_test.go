@@ -0,0 +1,67 @@
+package domain
+
+import "testing"
+
+func TestNotificationTargetValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		target NotificationTarget
+		ok     bool
+	}{
+		{"webhook", NotificationTarget{Kind: NotificationKindWebhook, URL: "https://example.com/hook"}, true},
+		{"slack without url", NotificationTarget{Kind: NotificationKindSlack}, false},
+		{"webhook with ftp url", NotificationTarget{Kind: NotificationKindWebhook, URL: "ftp://example.com"}, false},
+		{"email", NotificationTarget{Kind: NotificationKindEmail, Recipients: []string{"dev@example.com"}}, true},
+		{"email without recipients", NotificationTarget{Kind: NotificationKindEmail}, false},
+		{"email with bad recipient", NotificationTarget{Kind: NotificationKindEmail, Recipients: []string{"nope"}}, false},
+		{"unknown kind", NotificationTarget{Kind: "pager", URL: "https://example.com"}, false},
+		{"unknown filter", NotificationTarget{Kind: NotificationKindWebhook, URL: "https://example.com", On: "sometimes"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.target.Validate()
+			if (err == nil) != tt.ok {
+				t.Fatalf("Validate() = %v, want ok=%v", err, tt.ok)
+			}
+			if tt.ok && tt.target.On != NotifyAlways {
+				t.Errorf("Expected default filter always, got %q", tt.target.On)
+			}
+		})
+	}
+}
+
+func TestNotificationTargetWants(t *testing.T) {
+	build := func(branch string, status BuildStatus) *Build {
+		return &Build{Branch: branch, Status: status}
+	}
+	pullRequest := &Build{Branch: "main", Event: BuildEventPullRequest, Status: BuildStatusFailed}
+	tests := []struct {
+		name     string
+		target   NotificationTarget
+		build    *Build
+		previous *Build
+		want     bool
+	}{
+		{"always", NotificationTarget{On: NotifyAlways}, build("main", BuildStatusSuccess), nil, true},
+		{"failure on success", NotificationTarget{On: NotifyFailure}, build("main", BuildStatusSuccess), nil, false},
+		{"failure on failure", NotificationTarget{On: NotifyFailure}, build("main", BuildStatusFailed), nil, true},
+		{"failure on timeout", NotificationTarget{On: NotifyFailure}, build("main", BuildStatusTimedOut), nil, true},
+		{"failure on cancel", NotificationTarget{On: NotifyFailure}, build("main", BuildStatusCancelled), nil, false},
+		{"change goes red", NotificationTarget{On: NotifyChange}, build("main", BuildStatusFailed), build("main", BuildStatusSuccess), true},
+		{"change stays red", NotificationTarget{On: NotifyChange}, build("main", BuildStatusFailed), build("main", BuildStatusFailed), false},
+		{"change first build", NotificationTarget{On: NotifyChange}, build("main", BuildStatusSuccess), nil, true},
+		{"change on cancel", NotificationTarget{On: NotifyChange}, build("main", BuildStatusCancelled), build("main", BuildStatusSuccess), false},
+		{"branch filter", NotificationTarget{On: NotifyAlways, Branches: []string{"main", "release/*"}}, build("feature/x", BuildStatusFailed), nil, false},
+		{"branch glob", NotificationTarget{On: NotifyAlways, Branches: []string{"main", "release/*"}}, build("release/1.0", BuildStatusFailed), nil, true},
+		{"pull request into filtered branch", NotificationTarget{On: NotifyAlways, Branches: []string{"main"}}, pullRequest, nil, false},
+		{"pull request opted in", NotificationTarget{On: NotifyAlways, Branches: []string{"main"}, PullRequests: true}, pullRequest, nil, true},
+		{"pull request without filter", NotificationTarget{On: NotifyAlways}, pullRequest, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.target.Wants(tt.build, tt.previous); got != tt.want {
+				t.Errorf("Wants() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,12 +1,255 @@
 package domain
 
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
 type Pipeline struct {
-	Image string `yaml:"image"`
-	Steps []Step `yaml:"steps"`
+	Image     string     `yaml:"image"`
+	Timeout   Duration   `yaml:"timeout"`
+	Matrix    *Matrix    `yaml:"matrix"`
+	Cache     *Cache     `yaml:"cache"`
+	Artifacts *Artifacts `yaml:"artifacts"`
+	Services  []Service  `yaml:"services"`
+	Steps     []Step     `yaml:"steps"`
+}
+
+// Cache declares workspace paths, such as a module cache, that are restored
+// before the steps run and saved after they succeed. Key is a template, e.g.
+// go-{{ checksum "go.sum" }}; a build whose key matches an existing entry
+// restores it and does not save over it.
+type Cache struct {
+	Key   string   `yaml:"key"`
+	Paths []string `yaml:"paths"`
+}
+
+func (c *Cache) validate() error {
+	if c == nil {
+		return nil
+	}
+	if strings.TrimSpace(c.Key) == "" {
+		return fmt.Errorf("cache has no key")
+	}
+	if len(c.Paths) == 0 {
+		return fmt.Errorf("cache has no paths")
+	}
+	for _, p := range c.Paths {
+		clean := path.Clean(p)
+		if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return fmt.Errorf("cache path %q must be relative to the workspace", p)
+		}
+	}
+	return nil
+}
+
+// DefaultArtifactExpiry is how long artifacts are kept when expire_in is not set.
+const DefaultArtifactExpiry = 30 * 24 * time.Hour
+
+// Artifacts declares the files, as globs relative to the workspace, that are
+// kept once the steps have finished.
+type Artifacts struct {
+	Paths    []string `yaml:"paths"`
+	ExpireIn Duration `yaml:"expire_in"`
+}
+
+// Expiry returns how long the artifacts are kept.
+func (a *Artifacts) Expiry() time.Duration {
+	if a.ExpireIn == 0 {
+		return DefaultArtifactExpiry
+	}
+	return time.Duration(a.ExpireIn)
+}
+
+func (a *Artifacts) validate() error {
+	if a == nil {
+		return nil
+	}
+	if len(a.Paths) == 0 {
+		return fmt.Errorf("artifacts has no paths")
+	}
+	return validatePatterns(a.Paths)
+}
+
+// Service is a container, such as a database, that runs alongside the steps
+// of a build and is reachable from them by its name.
+type Service struct {
+	Name        string            `yaml:"name"`
+	Image       string            `yaml:"image"`
+	Env         map[string]string `yaml:"env"`
+	Ports       []int             `yaml:"ports"`
+	Healthcheck *Healthcheck      `yaml:"healthcheck"`
+}
+
+// Healthcheck tells when a service is ready. Test follows Docker's format,
+// e.g. ["CMD-SHELL", "pg_isready"]; a plain string is run with CMD-SHELL.
+type Healthcheck struct {
+	Test        HealthcheckTest `yaml:"test"`
+	Interval    Duration        `yaml:"interval"`
+	Timeout     Duration        `yaml:"timeout"`
+	StartPeriod Duration        `yaml:"start_period"`
+	Retries     int             `yaml:"retries"`
+}
+
+type HealthcheckTest []string
+
+func (t *HealthcheckTest) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*t = HealthcheckTest{"CMD-SHELL", value.Value}
+		return nil
+	}
+	var test []string
+	if err := value.Decode(&test); err != nil {
+		return err
+	}
+	*t = test
+	return nil
 }
 
 type Step struct {
-	Name     string            `yaml:"name"`
-	Commands []string          `yaml:"commands"`
-	Env      map[string]string `yaml:"env"`
+	Name      string            `yaml:"name"`
+	Image     string            `yaml:"image"`
+	Commands  []string          `yaml:"commands"`
+	Env       map[string]string `yaml:"env"`
+	Timeout   Duration          `yaml:"timeout"`
+	DependsOn []string          `yaml:"depends_on"`
+	When      *When             `yaml:"when"`
+}
+
+// ImageFor returns the image step runs in: its own image if set, otherwise the pipeline's.
+func (p *Pipeline) ImageFor(step Step) string {
+	if step.Image != "" {
+		return step.Image
+	}
+	return p.Image
+}
+
+// ParsePipeline decodes a .nanoci.yml document, rejecting any document
+// ValidatePipeline finds problems in. The error is then a ValidationErrors.
+func ParsePipeline(data []byte) (*Pipeline, error) {
+	p, errs := ValidatePipeline(data)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return p, nil
+}
+
+// Dependencies returns, for every step, the indices of the steps it waits
+// for. A pipeline that never uses depends_on runs strictly in order, so each
+// step depends on the one before it. Once any step declares depends_on, the
+// steps form a DAG and a step without depends_on starts immediately.
+func (p *Pipeline) Dependencies() ([][]int, error) {
+	index := make(map[string]int, len(p.Steps))
+	graph := false
+	for i, s := range p.Steps {
+		if _, dup := index[s.Name]; dup {
+			return nil, fmt.Errorf("duplicate step name %q", s.Name)
+		}
+		index[s.Name] = i
+		graph = graph || len(s.DependsOn) > 0
+	}
+
+	deps := make([][]int, len(p.Steps))
+	for i, s := range p.Steps {
+		if !graph {
+			if i > 0 {
+				deps[i] = []int{i - 1}
+			}
+			continue
+		}
+		for _, name := range s.DependsOn {
+			j, ok := index[name]
+			if !ok {
+				return nil, fmt.Errorf("step %q depends on unknown step %q", s.Name, name)
+			}
+			if j == i {
+				return nil, fmt.Errorf("step %q depends on itself", s.Name)
+			}
+			deps[i] = append(deps[i], j)
+		}
+	}
+
+	if cycle := findCycle(deps); cycle != nil {
+		names := make([]string, len(cycle))
+		for i, j := range cycle {
+			names[i] = p.Steps[j].Name
+		}
+		return nil, fmt.Errorf("dependency cycle between steps: %s", strings.Join(names, " -> "))
+	}
+	return deps, nil
+}
+
+// findCycle returns the steps of one dependency cycle, first step repeated
+// at the end, or nil if the graph is acyclic.
+func findCycle(deps [][]int) []int {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(deps))
+	var stack []int
+
+	var visit func(i int) []int
+	visit = func(i int) []int {
+		state[i] = visiting
+		stack = append(stack, i)
+		for _, j := range deps[i] {
+			switch state[j] {
+			case visiting:
+				for k, s := range stack {
+					if s == j {
+						return append(append([]int(nil), stack[k:]...), j)
+					}
+				}
+			case unvisited:
+				if c := visit(j); c != nil {
+					return c
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[i] = done
+		return nil
+	}
+
+	for i := range deps {
+		if state[i] == unvisited {
+			if c := visit(i); c != nil {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// Duration is a time.Duration written in .nanoci.yml as a Go duration string such as "10m".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+	if parsed < 0 {
+		return fmt.Errorf("invalid duration %q: must not be negative", s)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
 }
@@ -0,0 +1,137 @@
+package domain
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestPipelineTimeouts(t *testing.T) {
+	src := `
+image: alpine
+timeout: 30m
+steps:
+  - name: test
+    timeout: 90s
+    commands: ["true"]
+  - name: build
+    commands: ["true"]
+`
+	var p Pipeline
+	if err := yaml.Unmarshal([]byte(src), &p); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	if time.Duration(p.Timeout) != 30*time.Minute {
+		t.Errorf("Expected pipeline timeout 30m, got %s", p.Timeout)
+	}
+	if time.Duration(p.Steps[0].Timeout) != 90*time.Second {
+		t.Errorf("Expected step timeout 90s, got %s", p.Steps[0].Timeout)
+	}
+	if p.Steps[1].Timeout != 0 {
+		t.Errorf("Expected no timeout, got %s", p.Steps[1].Timeout)
+	}
+}
+
+func TestPipelineInvalidTimeout(t *testing.T) {
+	for _, v := range []string{"10", "ten minutes", "-5m"} {
+		var p Pipeline
+		if err := yaml.Unmarshal([]byte("timeout: "+v), &p); err == nil {
+			t.Errorf("Expected error for timeout %q", v)
+		}
+	}
+}
+
+func TestPipelineDependencies(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    [][]int
+		wantErr string
+	}{
+		{
+			name: "sequential without depends_on",
+			src:  "steps: [{name: a}, {name: b}, {name: c}]",
+			want: [][]int{nil, {0}, {1}},
+		},
+		{
+			name: "fan in",
+			src:  "steps: [{name: lint}, {name: test}, {name: build, depends_on: [lint, test]}]",
+			want: [][]int{nil, nil, {0, 1}},
+		},
+		{
+			name:    "unknown dependency",
+			src:     "steps: [{name: a, depends_on: [b]}]",
+			wantErr: `step "a" depends on unknown step "b"`,
+		},
+		{
+			name:    "cycle",
+			src:     "steps: [{name: a, depends_on: [c]}, {name: b, depends_on: [a]}, {name: c, depends_on: [b]}]",
+			wantErr: "dependency cycle between steps: a -> c -> b -> a",
+		},
+		{
+			name:    "duplicate names",
+			src:     "steps: [{name: a}, {name: a}]",
+			wantErr: `duplicate step name "a"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p Pipeline
+			if err := yaml.Unmarshal([]byte(tt.src), &p); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+			deps, err := p.Dependencies()
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Dependencies failed: %v", err)
+			}
+
+			if fmt.Sprint(deps) != fmt.Sprint(tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, deps)
+			}
+		})
+	}
+}
+
+func TestPipelineServices(t *testing.T) {
+	src := `
+services:
+  - name: postgres
+    image: postgres:16
+    ports: [5432]
+    healthcheck:
+      test: pg_isready -U postgres
+      interval: 2s
+      retries: 10
+  - name: redis
+    image: redis:7
+    healthcheck:
+      test: ["CMD", "redis-cli", "ping"]
+steps: [{name: test, image: golang, commands: [go test ./...]}]
+`
+	p, err := ParsePipeline([]byte(src))
+	if err != nil {
+		t.Fatalf("ParsePipeline failed: %v", err)
+	}
+
+	pg := p.Services[0].Healthcheck
+	if fmt.Sprint(pg.Test) != "[CMD-SHELL pg_isready -U postgres]" || time.Duration(pg.Interval) != 2*time.Second || pg.Retries != 10 {
+		t.Errorf("Unexpected postgres healthcheck: %+v", pg)
+	}
+	if fmt.Sprint(p.Services[1].Healthcheck.Test) != "[CMD redis-cli ping]" {
+		t.Errorf("Unexpected redis healthcheck: %v", p.Services[1].Healthcheck.Test)
+	}
+
+	if _, err := ParsePipeline([]byte("services: [{name: db}]")); err == nil {
+		t.Error("Expected error for service without image")
+	}
+}
@@ -0,0 +1,9 @@
+package domain
+
+import _ "embed"
+
+// PipelineSchema is the JSON Schema of .nanoci.yml, for editors and other
+// tooling. ValidatePipeline remains the authority on what a worker accepts.
+//
+//go:embed nanoci.schema.json
+var PipelineSchema []byte
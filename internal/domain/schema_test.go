@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestPipelineSchemaCoversFields keeps the published schema in step with the
+// fields the parser accepts.
+func TestPipelineSchemaCoversFields(t *testing.T) {
+	var schema struct {
+		Properties  map[string]json.RawMessage `json:"properties"`
+		Definitions map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"definitions"`
+	}
+	if err := json.Unmarshal(PipelineSchema, &schema); err != nil {
+		t.Fatalf("Invalid schema: %v", err)
+	}
+
+	var healthcheck struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	json.Unmarshal(schema.Definitions["service"].Properties["healthcheck"], &healthcheck)
+	var cache, artifacts struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	json.Unmarshal(schema.Properties["cache"], &cache)
+	json.Unmarshal(schema.Properties["artifacts"], &artifacts)
+
+	sections := []struct {
+		typ   reflect.Type
+		props map[string]json.RawMessage
+	}{
+		{reflect.TypeOf(Pipeline{}), schema.Properties},
+		{reflect.TypeOf(Step{}), schema.Definitions["step"].Properties},
+		{reflect.TypeOf(When{}), schema.Definitions["when"].Properties},
+		{reflect.TypeOf(Service{}), schema.Definitions["service"].Properties},
+		{reflect.TypeOf(Healthcheck{}), healthcheck.Properties},
+		{reflect.TypeOf(Cache{}), cache.Properties},
+		{reflect.TypeOf(Artifacts{}), artifacts.Properties},
+	}
+	for _, s := range sections {
+		for i := 0; i < s.typ.NumField(); i++ {
+			name := strings.Split(s.typ.Field(i).Tag.Get("yaml"), ",")[0]
+			if _, ok := s.props[name]; !ok {
+				t.Errorf("Schema is missing %s.%s", s.typ.Name(), name)
+			}
+		}
+		if len(s.props) != s.typ.NumField() {
+			t.Errorf("Schema for %s has %d properties, expected %d", s.typ.Name(), len(s.props), s.typ.NumField())
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package domain
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError is a problem in a .nanoci.yml document, located by the
+// line and column it starts at. Column is 0 when the YAML parser could not
+// tell.
+type ValidationError struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	if e.Column == 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+	}
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// ValidationErrors lists every problem found in a document.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ValidatePipeline strictly decodes a .nanoci.yml document. Unlike a plain
+// yaml.Unmarshal it rejects unknown fields and values of the wrong shape,
+// and checks that the pipeline can actually run: it has steps, every step
+// has a name, commands and an image, names are unique, dependencies exist
+// and form no cycle. All problems found are returned, not just the first.
+func ValidatePipeline(data []byte) (*Pipeline, ValidationErrors) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, ValidationErrors{syntaxError(err)}
+	}
+	root := &doc
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	if root.Kind == 0 || isNull(root) {
+		return nil, ValidationErrors{{Line: 1, Column: 1, Message: "pipeline is empty"}}
+	}
+
+	v := &validator{}
+	v.check(root, reflect.TypeOf(Pipeline{}), "pipeline")
+	if len(v.errs) > 0 {
+		return nil, v.errs
+	}
+
+	var p Pipeline
+	if err := root.Decode(&p); err != nil {
+		return nil, ValidationErrors{syntaxError(err)}
+	}
+	v.checkPipeline(&p, root)
+	if len(v.errs) > 0 {
+		return nil, v.errs
+	}
+	return &p, nil
+}
+
+type validator struct {
+	errs ValidationErrors
+}
+
+func (v *validator) add(n *yaml.Node, format string, args ...interface{}) {
+	v.errs = append(v.errs, ValidationError{Line: n.Line, Column: n.Column, Message: fmt.Sprintf(format, args...)})
+}
+
+var (
+	durationType   = reflect.TypeOf(Duration(0))
+	stringListType = reflect.TypeOf(StringList(nil))
+	healthTestType = reflect.TypeOf(HealthcheckTest(nil))
+	matrixType     = reflect.TypeOf(Matrix{})
+)
+
+// sectionNames names the parts of a pipeline in messages.
+var sectionNames = map[reflect.Type]string{
+	reflect.TypeOf(Pipeline{}):    "pipeline",
+	reflect.TypeOf(Step{}):        "step",
+	reflect.TypeOf(Service{}):     "service",
+	reflect.TypeOf(Healthcheck{}): "healthcheck",
+	reflect.TypeOf(When{}):        "when",
+	reflect.TypeOf(Cache{}):       "cache",
+	reflect.TypeOf(Artifacts{}):   "artifacts",
+}
+
+// check verifies that n has the shape the decoder expects for t. field names
+// the value in messages.
+func (v *validator) check(n *yaml.Node, t reflect.Type, field string) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if isNull(n) {
+		return
+	}
+
+	switch t {
+	case durationType:
+		if !v.scalar(n, field) {
+			return
+		}
+		d, err := time.ParseDuration(n.Value)
+		if err != nil || d < 0 {
+			v.add(n, "%s: invalid duration %q, expected a value such as 30s or 10m", field, n.Value)
+		}
+		return
+	case stringListType, healthTestType:
+		if n.Kind == yaml.ScalarNode {
+			return
+		}
+		v.check(n, reflect.TypeOf([]string(nil)), field)
+		return
+	case matrixType:
+		v.checkMatrix(n)
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		v.check(n, t.Elem(), field)
+	case reflect.Struct:
+		if n.Kind != yaml.MappingNode {
+			v.add(n, "%s must be a mapping", field)
+			return
+		}
+		name := sectionNames[t]
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, val := n.Content[i], n.Content[i+1]
+			f, ok := fieldByTag(t, key.Value)
+			if !ok {
+				v.add(key, "unknown field %q in %s", key.Value, name)
+				continue
+			}
+			v.check(val, f.Type, key.Value)
+		}
+	case reflect.Slice:
+		if n.Kind != yaml.SequenceNode {
+			v.add(n, "%s must be a list", field)
+			return
+		}
+		for _, item := range n.Content {
+			v.check(item, t.Elem(), field)
+		}
+	case reflect.Map:
+		if n.Kind != yaml.MappingNode {
+			v.add(n, "%s must be a mapping", field)
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			v.check(n.Content[i+1], t.Elem(), field+"."+n.Content[i].Value)
+		}
+	case reflect.Int:
+		if v.scalar(n, field) {
+			if _, err := strconv.Atoi(n.Value); err != nil {
+				v.add(n, "%s: expected a whole number, got %q", field, n.Value)
+			}
+		}
+	case reflect.String:
+		v.scalar(n, field)
+	}
+}
+
+func (v *validator) scalar(n *yaml.Node, field string) bool {
+	if n.Kind != yaml.ScalarNode {
+		v.add(n, "%s must be a single value", field)
+		return false
+	}
+	return true
+}
+
+func (v *validator) checkMatrix(n *yaml.Node) {
+	if n.Kind != yaml.MappingNode {
+		v.add(n, "matrix must be a mapping")
+		return
+	}
+	combos := reflect.TypeOf([]map[string]string(nil))
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, val := n.Content[i], n.Content[i+1]
+		switch key.Value {
+		case "exclude", "include":
+			v.check(val, combos, key.Value)
+		default:
+			if !axisName.MatchString(key.Value) {
+				v.add(key, "matrix axis %q must be an upper-case env var name", key.Value)
+				continue
+			}
+			if val.Kind == yaml.SequenceNode && len(val.Content) == 0 {
+				v.add(key, "matrix axis %q has no values", key.Value)
+				continue
+			}
+			v.check(val, reflect.TypeOf([]string(nil)), key.Value)
+		}
+	}
+}
+
+// checkPipeline verifies what a well-formed document must also get right
+// for the pipeline to run.
+func (v *validator) checkPipeline(p *Pipeline, root *yaml.Node) {
+	stepsNode := valueOf(root, "steps")
+	if len(p.Steps) == 0 {
+		at := root
+		if stepsNode != nil {
+			at = stepsNode
+		}
+		v.add(at, "pipeline has no steps")
+	}
+
+	index := make(map[string]int, len(p.Steps))
+	for i, s := range p.Steps {
+		node := stepsNode.Content[i]
+		nameNode := valueOf(node, "name")
+		switch {
+		case s.Name == "":
+			v.add(node, "step %d has no name", i+1)
+		case index[s.Name] > 0:
+			v.add(nameNode, "duplicate step name %q", s.Name)
+		default:
+			index[s.Name] = i + 1
+		}
+
+		label := stepLabel(s, i)
+		if len(s.Commands) == 0 {
+			at := node
+			if c := valueOf(node, "commands"); c != nil {
+				at = c
+			}
+			v.add(at, "%s has no commands", label)
+		}
+		for j, c := range s.Commands {
+			if strings.TrimSpace(c) == "" {
+				v.add(valueOf(node, "commands").Content[j], "%s has an empty command", label)
+			}
+		}
+		if p.ImageFor(s) == "" {
+			v.add(node, "%s has no image and the pipeline sets no default", label)
+		}
+		if err := s.When.validate(); err != nil {
+			v.add(valueOf(node, "when"), "%s: when: %s", label, err)
+		}
+	}
+
+	// Dependencies are only meaningful between uniquely named steps
+	if len(v.errs) == 0 {
+		for i, s := range p.Steps {
+			deps := valueOf(stepsNode.Content[i], "depends_on")
+			for j, name := range s.DependsOn {
+				switch k, ok := index[name]; {
+				case !ok:
+					v.add(deps.Content[j], "step %q depends on unknown step %q", s.Name, name)
+				case k-1 == i:
+					v.add(deps.Content[j], "step %q depends on itself", s.Name)
+				}
+			}
+		}
+	}
+	if len(v.errs) == 0 {
+		if _, err := p.Dependencies(); err != nil {
+			v.add(stepsNode, "%s", err)
+		}
+	}
+
+	servicesNode := valueOf(root, "services")
+	seen := make(map[string]bool, len(p.Services))
+	for i, svc := range p.Services {
+		node := servicesNode.Content[i]
+		switch {
+		case svc.Name == "":
+			v.add(node, "service %d has no name", i+1)
+		case seen[svc.Name]:
+			v.add(valueOf(node, "name"), "duplicate service name %q", svc.Name)
+		}
+		seen[svc.Name] = true
+		if svc.Image == "" {
+			v.add(node, "service %q has no image", svc.Name)
+		}
+	}
+
+	if err := p.Cache.validate(); err != nil {
+		v.add(valueOf(root, "cache"), "%s", err)
+	}
+	if err := p.Artifacts.validate(); err != nil {
+		v.add(valueOf(root, "artifacts"), "%s", err)
+	}
+	if p.Matrix != nil && len(p.Matrix.Combinations()) == 0 {
+		v.add(valueOf(root, "matrix"), "matrix has no combinations")
+	}
+}
+
+func stepLabel(s Step, i int) string {
+	if s.Name == "" {
+		return fmt.Sprintf("step %d", i+1)
+	}
+	return fmt.Sprintf("step %q", s.Name)
+}
+
+// valueOf returns the value of key in the mapping n, or nil.
+func valueOf(n *yaml.Node, key string) *yaml.Node {
+	if n == nil {
+		return nil
+	}
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			v := n.Content[i+1]
+			if v.Kind == yaml.AliasNode {
+				v = v.Alias
+			}
+			return v
+		}
+	}
+	return nil
+}
+
+func fieldByTag(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if strings.Split(f.Tag.Get("yaml"), ",")[0] == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func isNull(n *yaml.Node) bool {
+	return n.Kind == yaml.ScalarNode && n.Tag == "!!null"
+}
+
+var yamlLine = regexp.MustCompile(`line (\d+)(?:, column (\d+))?: (.*)`)
+
+// syntaxError turns an error from the YAML parser into a ValidationError.
+func syntaxError(err error) ValidationError {
+	msg := strings.TrimPrefix(err.Error(), "yaml: ")
+	if m := yamlLine.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		col, _ := strconv.Atoi(m[2])
+		return ValidationError{Line: line, Column: col, Message: m[3]}
+	}
+	return ValidationError{Line: 1, Message: msg}
+}
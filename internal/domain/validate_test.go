@@ -0,0 +1,116 @@
+package domain
+
+import (
+	"testing"
+)
+
+func TestValidatePipeline(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []ValidationError
+	}{
+		{
+			name: "valid",
+			src: `image: alpine
+steps:
+  - name: test
+    commands: [go test ./...]
+`,
+		},
+		{
+			name: "unknown fields",
+			src: `image: alpine
+step:
+  - name: test
+steps:
+  - name: test
+    comands: [go test ./...]
+`,
+			want: []ValidationError{
+				{Line: 2, Column: 1, Message: `unknown field "step" in pipeline`},
+				{Line: 6, Column: 5, Message: `unknown field "comands" in step`},
+			},
+		},
+		{
+			name: "invalid duration",
+			src: `image: alpine
+timeout: ten minutes
+steps:
+  - name: test
+    commands: ["true"]
+`,
+			want: []ValidationError{
+				{Line: 2, Column: 10, Message: `timeout: invalid duration "ten minutes", expected a value such as 30s or 10m`},
+			},
+		},
+		{
+			name: "missing names, duplicates and empty commands",
+			src: `image: alpine
+steps:
+  - commands: ["true"]
+  - name: test
+    commands: []
+  - name: test
+    commands: ["make", ""]
+`,
+			want: []ValidationError{
+				{Line: 3, Column: 5, Message: `step 1 has no name`},
+				{Line: 5, Column: 15, Message: `step "test" has no commands`},
+				{Line: 6, Column: 11, Message: `duplicate step name "test"`},
+				{Line: 7, Column: 24, Message: `step "test" has an empty command`},
+			},
+		},
+		{
+			name: "no steps",
+			src:  "image: alpine\nsteps: []\n",
+			want: []ValidationError{{Line: 2, Column: 8, Message: "pipeline has no steps"}},
+		},
+		{
+			name: "unknown dependency",
+			src: `image: alpine
+steps:
+  - name: build
+    depends_on: [tset]
+    commands: ["true"]
+`,
+			want: []ValidationError{{Line: 4, Column: 18, Message: `step "build" depends on unknown step "tset"`}},
+		},
+		{
+			name: "matrix axis names",
+			src: `image: alpine
+matrix:
+  GO_VERSION: ["1.22"]
+  exlude:
+    - {GO_VERSION: "1.22"}
+  node-version: ["20"]
+steps:
+  - name: test
+    commands: ["true"]
+`,
+			want: []ValidationError{
+				{Line: 4, Column: 3, Message: `matrix axis "exlude" must be an upper-case env var name`},
+				{Line: 6, Column: 3, Message: `matrix axis "node-version" must be an upper-case env var name`},
+			},
+		},
+		{
+			name: "syntax error",
+			src:  "steps:\n  - name: [\n",
+			want: []ValidationError{{Line: 2, Message: "did not find expected node content"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, errs := ValidatePipeline([]byte(tt.src))
+			if len(errs) != len(tt.want) {
+				t.Fatalf("Expected %d errors, got %v", len(tt.want), errs)
+			}
+			for i, want := range tt.want {
+				if errs[i] != want {
+					t.Errorf("Expected %+v, got %+v", want, errs[i])
+				}
+			}
+		})
+	}
+}
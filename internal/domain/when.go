@@ -0,0 +1,187 @@
+package domain
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StepCondition tells when a step runs relative to the outcome of the steps
+// before it.
+type StepCondition string
+
+const (
+	// ConditionOnSuccess runs the step only if its dependencies succeeded. It is the default.
+	ConditionOnSuccess StepCondition = "on_success"
+	// ConditionOnFailure runs the step only once some step of the build has failed.
+	ConditionOnFailure StepCondition = "on_failure"
+	// ConditionAlways runs the step whatever happened before it.
+	ConditionAlways StepCondition = "always"
+)
+
+// When restricts the builds a step runs in. Every filter that is set must
+// match; branch, tag and paths take glob patterns where ** also matches
+// slashes. A tag filter only matches tag builds.
+type When struct {
+	Branch StringList    `yaml:"branch"`
+	Tag    StringList    `yaml:"tag"`
+	Event  StringList    `yaml:"event"`
+	Paths  StringList    `yaml:"paths"`
+	Status StepCondition `yaml:"status"`
+}
+
+// StringList is a list of strings that may be written in YAML as a single scalar.
+type StringList []string
+
+func (l *StringList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = StringList{value.Value}
+		return nil
+	}
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// Condition returns the status condition of the step, on_success if unset.
+func (w *When) Condition() StepCondition {
+	if w == nil || w.Status == "" {
+		return ConditionOnSuccess
+	}
+	return w.Status
+}
+
+// Match evaluates the branch, event and paths filters against build. It
+// returns whether they all match along with a description of each filter
+// that was checked, for the build log.
+func (w *When) Match(build *Build) (bool, []string) {
+	if w == nil {
+		return true, nil
+	}
+	match := true
+	var notes []string
+
+	if len(w.Branch) > 0 {
+		ok := MatchAny(w.Branch, build.Branch)
+		notes = append(notes, describe("branch", build.Branch, w.Branch, ok))
+		match = match && ok
+	}
+
+	if len(w.Tag) > 0 {
+		ok := build.Tag != "" && MatchAny(w.Tag, build.Tag)
+		notes = append(notes, describe("tag", build.Tag, w.Tag, ok))
+		match = match && ok
+	}
+
+	if len(w.Event) > 0 {
+		ok := false
+		for _, e := range w.Event {
+			ok = ok || BuildEvent(e) == build.Event
+		}
+		notes = append(notes, describe("event", string(build.Event), w.Event, ok))
+		match = match && ok
+	}
+
+	if len(w.Paths) > 0 {
+		switch {
+		case len(build.ChangedFiles) == 0:
+			// Manual builds and some webhooks carry no file list; run rather than guess
+			notes = append(notes, fmt.Sprintf("paths %v: changed files unknown, assuming a match", []string(w.Paths)))
+		default:
+			ok := false
+			for _, f := range build.ChangedFiles {
+				if MatchAny(w.Paths, f) {
+					ok = true
+					break
+				}
+			}
+			if ok {
+				notes = append(notes, fmt.Sprintf("paths %v: changed files match", []string(w.Paths)))
+			} else {
+				notes = append(notes, fmt.Sprintf("paths %v: no changed file matches", []string(w.Paths)))
+			}
+			match = match && ok
+		}
+	}
+	return match, notes
+}
+
+func (w *When) validate() error {
+	if w == nil {
+		return nil
+	}
+	switch w.Status {
+	case "", ConditionOnSuccess, ConditionOnFailure, ConditionAlways:
+	default:
+		return fmt.Errorf("unknown status %q, expected on_success, on_failure or always", w.Status)
+	}
+	for _, e := range w.Event {
+		switch BuildEvent(e) {
+		case BuildEventPush, BuildEventPullRequest, BuildEventTag, BuildEventManual:
+		default:
+			return fmt.Errorf("unknown event %q, expected push, pull_request, tag or manual", e)
+		}
+	}
+	patterns := append(append(append([]string(nil), w.Branch...), w.Tag...), w.Paths...)
+	return validatePatterns(patterns)
+}
+
+func validatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := globRegexp(pattern); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+func describe(filter, value string, patterns []string, ok bool) string {
+	verb := "does not match"
+	if ok {
+		verb = "matches"
+	}
+	return fmt.Sprintf("%s %q %s %v", filter, value, verb, patterns)
+}
+
+// MatchAny reports whether the slash-separated path name matches any of the
+// glob patterns, as used by when: and artifacts:.
+func MatchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if re, err := globRegexp(p); err == nil && re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// globRegexp compiles a glob pattern. * and ? stop at slashes, ** does not,
+// and a leading **/ also matches files at the top level.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**/") {
+				b.WriteString("(?:.*/)?")
+				i += 2
+			} else if strings.HasPrefix(pattern[i:], "**") {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
@@ -0,0 +1,81 @@
+package domain
+
+import "testing"
+
+func TestWhenMatch(t *testing.T) {
+	build := &Build{
+		Branch:       "release/1.2",
+		Event:        BuildEventPush,
+		ChangedFiles: []string{"docs/guide/setup.md", "README.md"},
+	}
+
+	tests := []struct {
+		name string
+		when *When
+		want bool
+	}{
+		{"no conditions", nil, true},
+		{"branch glob", &When{Branch: StringList{"main", "release/*"}}, true},
+		{"branch mismatch", &When{Branch: StringList{"main"}}, false},
+		{"star stops at slash", &When{Branch: StringList{"*"}}, false},
+		{"event", &When{Event: StringList{"push", "tag"}}, true},
+		{"event mismatch", &When{Event: StringList{"pull_request"}}, false},
+		{"double star paths", &When{Paths: StringList{"docs/**"}}, true},
+		{"top level double star", &When{Paths: StringList{"**/*.md"}}, true},
+		{"paths mismatch", &When{Paths: StringList{"src/**"}}, false},
+		{"all must match", &When{Branch: StringList{"release/*"}, Event: StringList{"tag"}}, false},
+		{"tag filter on branch build", &When{Tag: StringList{"*"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, notes := tt.when.Match(build)
+			if got != tt.want {
+				t.Errorf("Expected %v, got %v (%v)", tt.want, got, notes)
+			}
+		})
+	}
+
+	// Without a file list, path filters cannot rule a step out
+	unknown := &Build{Branch: "main", Event: BuildEventManual}
+	if ok, _ := (&When{Paths: StringList{"src/**"}}).Match(unknown); !ok {
+		t.Error("Expected paths to match when changed files are unknown")
+	}
+
+	release := &Build{Tag: "v1.4.0", Event: BuildEventTag}
+	if ok, notes := (&When{Tag: StringList{"v*"}}).Match(release); !ok {
+		t.Errorf("Expected tag glob to match %q (%v)", release.Tag, notes)
+	}
+	if ok, _ := (&When{Tag: StringList{"v2.*"}}).Match(release); ok {
+		t.Error("Expected tag glob not to match")
+	}
+}
+
+func TestParsePipelineWhen(t *testing.T) {
+	src := `
+image: alpine
+steps:
+  - name: deploy
+    commands: [./deploy.sh]
+    when:
+      branch: main
+      event: [push, tag]
+      status: always
+`
+	p, err := ParsePipeline([]byte(src))
+	if err != nil {
+		t.Fatalf("ParsePipeline failed: %v", err)
+	}
+	w := p.Steps[0].When
+	if len(w.Branch) != 1 || w.Branch[0] != "main" || len(w.Event) != 2 || w.Condition() != ConditionAlways {
+		t.Errorf("Unexpected when: %+v", w)
+	}
+
+	for _, bad := range []string{
+		"steps: [{name: a, when: {status: sometimes}}]",
+		"steps: [{name: a, when: {event: deploy}}]",
+	} {
+		if _, err := ParsePipeline([]byte(bad)); err == nil {
+			t.Errorf("Expected error for %s", bad)
+		}
+	}
+}
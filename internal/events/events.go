@@ -0,0 +1,64 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"go.uber.org/zap"
+)
+
+// Type names what happened, e.g. build.finished.
+type Type string
+
+const (
+	BuildQueued   Type = "build.queued"
+	BuildStarted  Type = "build.started"
+	StepStarted   Type = "step.started"
+	StepFinished  Type = "step.finished"
+	BuildFinished Type = "build.finished"
+)
+
+// Event reports a change in the lifecycle of a build. Build is a snapshot
+// taken when the event was published; Step is set for step events only.
+type Event struct {
+	ID        string            `json:"id,omitempty"`
+	Type      Type              `json:"type"`
+	Time      time.Time         `json:"time"`
+	ProjectID uuid.UUID         `json:"project_id"`
+	BuildID   uuid.UUID         `json:"build_id"`
+	Build     *domain.Build     `json:"build"`
+	Step      *domain.BuildStep `json:"step,omitempty"`
+}
+
+// New returns an event of type t about build and, optionally, one of its steps.
+func New(t Type, build *domain.Build, step *domain.BuildStep) *Event {
+	return &Event{
+		Type:      t,
+		Time:      time.Now().UTC(),
+		ProjectID: build.ProjectID,
+		BuildID:   build.ID,
+		Build:     build,
+		Step:      step,
+	}
+}
+
+// Bus carries events from the components that produce them to anyone
+// interested, such as the dashboard.
+type Bus interface {
+	Publish(ctx context.Context, e *Event) error
+	// Subscribe delivers the events published after since, an ID returned
+	// with an earlier event, or from now on if since is empty. The channel is
+	// closed once ctx is done.
+	Subscribe(ctx context.Context, since string) <-chan *Event
+}
+
+// Emit publishes an event of type t. Events are informational, so a failure
+// to publish one is logged rather than returned, and the publish outlives a
+// cancelled ctx.
+func Emit(ctx context.Context, bus Bus, t Type, build *domain.Build, step *domain.BuildStep) {
+	if err := bus.Publish(context.WithoutCancel(ctx), New(t, build, step)); err != nil {
+		zap.L().Warn("failed to publish event", zap.String("type", string(t)), zap.String("build_id", build.ID.String()), zap.Error(err))
+	}
+}
@@ -0,0 +1,101 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	eventStream = "nanoci:events"
+	// eventStreamMaxLen bounds how far back subscribers can resume.
+	eventStreamMaxLen = 10000
+	readTimeout       = 5 * time.Second
+	retryDelay        = time.Second
+)
+
+// RedisBus keeps events in the Redis stream nanoci:events, so a subscriber
+// that reconnects can pick up where it left off.
+type RedisBus struct {
+	rdb *redis.Client
+}
+
+func NewRedisBus(rdb *redis.Client) *RedisBus {
+	return &RedisBus{rdb: rdb}
+}
+
+func (b *RedisBus) Publish(ctx context.Context, e *Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return b.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: eventStream,
+		MaxLen: eventStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"type": string(e.Type), "event": data},
+	}).Err()
+}
+
+func (b *RedisBus) Subscribe(ctx context.Context, since string) <-chan *Event {
+	ch := make(chan *Event)
+	cursor := since
+	if cursor == "" {
+		cursor = "$"
+	}
+
+	go func() {
+		defer close(ch)
+		for ctx.Err() == nil {
+			res, err := b.rdb.XRead(ctx, &redis.XReadArgs{
+				Streams: []string{eventStream, cursor},
+				Block:   readTimeout,
+			}).Result()
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				zap.L().Error("failed to read events", zap.Error(err))
+				select {
+				case <-ctx.Done():
+				case <-time.After(retryDelay):
+				}
+				continue
+			}
+
+			for _, s := range res {
+				for _, msg := range s.Messages {
+					cursor = msg.ID
+					e, err := decode(msg)
+					if err != nil {
+						zap.L().Warn("skipping malformed event", zap.String("id", msg.ID), zap.Error(err))
+						continue
+					}
+					select {
+					case ch <- e:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+func decode(msg redis.XMessage) (*Event, error) {
+	data, _ := msg.Values["event"].(string)
+	var e Event
+	if err := json.Unmarshal([]byte(data), &e); err != nil {
+		return nil, err
+	}
+	e.ID = msg.ID
+	return &e, nil
+}
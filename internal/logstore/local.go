@@ -0,0 +1,71 @@
+package logstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// LocalStore keeps logs on the local filesystem under <dir>/<buildID>/<step>.log.
+type LocalStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewLocalStore(dir string) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalStore{dir: dir}, nil
+}
+
+func (s *LocalStore) Append(ctx context.Context, buildID, step string, lines []Line) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := s.path(buildID, step)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, l := range lines {
+		if err := enc.Encode(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *LocalStore) Open(ctx context.Context, buildID, step string) (io.ReadSeekCloser, error) {
+	f, err := os.Open(s.path(buildID, step))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, buildID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return os.RemoveAll(filepath.Dir(s.path(buildID, SetupLog)))
+}
+
+func (s *LocalStore) path(buildID, step string) string {
+	return filepath.Join(s.dir, url.PathEscape(buildID), url.PathEscape(step)+".log")
+}
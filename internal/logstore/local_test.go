@@ -0,0 +1,88 @@
+package logstore
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriterPersistsNumberedLines(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStore failed: %v", err)
+	}
+
+	ctx := context.Background()
+	w := NewWriter(ctx, store, "build-1", "test")
+	w.Write([]byte("first\r\nsec"))
+	w.Write([]byte("ond\nthird"))
+	w.Close()
+
+	f, err := store.Open(ctx, "build-1", "test")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+
+	var lines []Line
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var l Line
+		if err := json.Unmarshal(sc.Bytes(), &l); err != nil {
+			t.Fatalf("invalid line %q: %v", sc.Text(), err)
+		}
+		lines = append(lines, l)
+	}
+
+	want := []string{"first", "second", "third"}
+	if len(lines) != len(want) {
+		t.Fatalf("Expected %d lines, got %d", len(want), len(lines))
+	}
+	for i, l := range lines {
+		if l.Text != want[i] || l.Number != i+1 || l.Step != "test" {
+			t.Errorf("line %d: got %+v", i, l)
+		}
+	}
+}
+
+func TestOpenMissingLog(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStore failed: %v", err)
+	}
+
+	if _, err := store.Open(context.Background(), "build-1", "missing"); err != ErrNotFound {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestDeleteBuildLogs(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStore failed: %v", err)
+	}
+
+	ctx := context.Background()
+	for _, build := range []string{"build-1", "build-2"} {
+		if err := store.Append(ctx, build, "test", []Line{{Step: "test", Number: 1, Text: "ok"}}); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	if err := store.Delete(ctx, "build-1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.Open(ctx, "build-1", "test"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if f, err := store.Open(ctx, "build-2", "test"); err != nil {
+		t.Errorf("Expected other builds to keep their logs, got %v", err)
+	} else {
+		f.Close()
+	}
+
+	// Builds without logs are no error
+	if err := store.Delete(ctx, "build-3"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package logstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/princetheprogrammerbtw/nanoci/internal/config"
+)
+
+var ErrNotFound = errors.New("log not found")
+
+// SetupLog is the log of a build's own output, such as checkout, services,
+// cache and artifacts, kept alongside the logs of its steps.
+const SetupLog = "_setup"
+
+// Line is a single line of step output as it is persisted.
+type Line struct {
+	Step   string    `json:"step"`
+	Number int       `json:"n"`
+	Time   time.Time `json:"ts"`
+	Text   string    `json:"text"`
+}
+
+// Store persists build logs so they can be replayed once the live stream is gone.
+// Logs are kept per build and per step as newline-delimited JSON Lines.
+type Store interface {
+	Append(ctx context.Context, buildID, step string, lines []Line) error
+	Open(ctx context.Context, buildID, step string) (io.ReadSeekCloser, error)
+	// Delete removes every log of a build, so a build that runs again does
+	// not append to the logs of its earlier attempt.
+	Delete(ctx context.Context, buildID string) error
+}
+
+// New returns the Store selected by cfg.LogStore.
+func New(cfg *config.Config) (Store, error) {
+	switch cfg.LogStore {
+	case "", "local":
+		return NewLocalStore(cfg.LogDir)
+	default:
+		return nil, fmt.Errorf("unknown log store: %s", cfg.LogStore)
+	}
+}
@@ -0,0 +1,86 @@
+package logstore
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Writer splits raw step output into numbered, timestamped lines and appends
+// them to a Store. Partial lines are buffered until a newline or Close.
+type Writer struct {
+	ctx     context.Context
+	store   Store
+	buildID string
+	step    string
+
+	mu     sync.Mutex
+	buf    []byte
+	number int
+}
+
+func NewWriter(ctx context.Context, store Store, buildID, step string) *Writer {
+	return &Writer{
+		ctx:     ctx,
+		store:   store,
+		buildID: buildID,
+		step:    step,
+	}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	now := time.Now()
+
+	var lines []Line
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		lines = append(lines, w.nextLine(w.buf[:i], now))
+		w.buf = w.buf[i+1:]
+	}
+	w.append(lines)
+
+	// Persisting is best effort: a failing store must not stop the live stream.
+	return len(p), nil
+}
+
+// Close flushes any trailing partial line.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+	w.append([]Line{w.nextLine(w.buf, time.Now())})
+	w.buf = nil
+	return nil
+}
+
+func (w *Writer) nextLine(b []byte, now time.Time) Line {
+	w.number++
+	return Line{
+		Step:   w.step,
+		Number: w.number,
+		Time:   now,
+		Text:   string(bytes.TrimSuffix(b, []byte("\r"))),
+	}
+}
+
+func (w *Writer) append(lines []Line) {
+	if len(lines) == 0 {
+		return
+	}
+	if err := w.store.Append(w.ctx, w.buildID, w.step, lines); err != nil {
+		zap.L().Error("failed to persist logs", zap.String("build_id", w.buildID), zap.String("step", w.step), zap.Error(err))
+	}
+}
@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"github.com/princetheprogrammerbtw/nanoci/internal/events"
+)
+
+// Message is the body of a webhook delivery and the source of the text sent
+// to chat and email targets.
+type Message struct {
+	Event      events.Type   `json:"event"`
+	DeliveryID uuid.UUID     `json:"delivery_id"`
+	Project    Project       `json:"project"`
+	Build      *domain.Build `json:"build"`
+	URL        string        `json:"url"`
+}
+
+type Project struct {
+	ID      uuid.UUID `json:"id"`
+	Name    string    `json:"name"`
+	RepoURL string    `json:"repo_url"`
+}
+
+var outcomes = map[domain.BuildStatus]string{
+	domain.BuildStatusSuccess:   "passed",
+	domain.BuildStatusFailed:    "failed",
+	domain.BuildStatusTimedOut:  "timed out",
+	domain.BuildStatusCancelled: "was cancelled",
+}
+
+// Summary describes the result in one line, e.g.
+// "nanoci: api build on main failed (1a2b3c4 Fix login)".
+func (m *Message) Summary() string {
+	outcome, ok := outcomes[m.Build.Status]
+	if !ok {
+		outcome = strings.ToLower(string(m.Build.Status))
+	}
+	name := m.Project.Name
+	if name == "" {
+		name = m.Project.ID.String()
+	}
+
+	commit := m.Build.CommitHash
+	if len(commit) > 7 {
+		commit = commit[:7]
+	}
+	if subject, _, _ := strings.Cut(m.Build.CommitMessage, "\n"); subject != "" {
+		commit += " " + subject
+	}
+	ref := m.Build.Branch
+	if m.Build.Tag != "" {
+		ref = "tag " + m.Build.Tag
+	}
+	return fmt.Sprintf("nanoci: %s build on %s %s (%s)", name, ref, outcome, commit)
+}
@@ -0,0 +1,191 @@
+package notify
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/princetheprogrammerbtw/nanoci/internal/config"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"github.com/princetheprogrammerbtw/nanoci/internal/events"
+	"github.com/princetheprogrammerbtw/nanoci/pkg/crypto"
+	"go.uber.org/zap"
+)
+
+// retryDelays are the waits between attempts at a delivery; once they are
+// used up the delivery is marked FAILED.
+var retryDelays = []time.Duration{10 * time.Second, 30 * time.Second, 2 * time.Minute, 10 * time.Minute}
+
+// Notifier sends the results of finished builds to their project's
+// notification targets. Deliveries run in the background and are recorded,
+// attempt by attempt, in the delivery log.
+type Notifier struct {
+	repo          domain.NotificationRepository
+	buildRepo     domain.BuildRepository
+	projectRepo   domain.ProjectRepository
+	senders       map[domain.NotificationKind]Sender
+	encryptionKey []byte
+	publicURL     string
+	delays        []time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewNotifier(repo domain.NotificationRepository, br domain.BuildRepository, pr domain.ProjectRepository, cfg *config.Config) *Notifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Notifier{
+		repo:        repo,
+		buildRepo:   br,
+		projectRepo: pr,
+		senders: map[domain.NotificationKind]Sender{
+			domain.NotificationKindWebhook: NewWebhookSender(),
+			domain.NotificationKindSlack:   NewSlackSender(),
+			domain.NotificationKindEmail:   NewEmailSender(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom),
+		},
+		encryptionKey: []byte(cfg.EncryptionKey),
+		publicURL:     strings.TrimRight(cfg.PublicURL, "/"),
+		delays:        retryDelays,
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+// Notify starts delivering build, which has just finished, to every target
+// of its project that wants it. Matrix children are reported through their
+// parent.
+func (n *Notifier) Notify(ctx context.Context, build *domain.Build) {
+	if build.ParentID != nil {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	log := zap.L().With(zap.String("build_id", build.ID.String()))
+
+	targets, err := n.repo.ListTargetsByProjectID(ctx, build.ProjectID)
+	if err != nil {
+		log.Error("failed to list notification targets", zap.Error(err))
+		return
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	project := Project{ID: build.ProjectID}
+	if p, err := n.projectRepo.GetByID(ctx, build.ProjectID); err != nil {
+		log.Warn("failed to load project for notifications", zap.Error(err))
+	} else if p != nil {
+		project.Name, project.RepoURL = p.Name, p.RepoURL
+	}
+
+	var previous *domain.Build
+	loaded := false
+	for _, target := range targets {
+		if target.On == domain.NotifyChange && !loaded {
+			loaded = true
+			// Without the previous build every result counts as a change
+			if previous, err = n.buildRepo.GetPrevious(ctx, build); err != nil {
+				log.Warn("failed to load previous build", zap.Error(err))
+			}
+		}
+		if !target.Wants(build, previous) {
+			continue
+		}
+
+		secret, err := crypto.Decrypt(target.EncryptedSecret, n.encryptionKey)
+		if err != nil {
+			log.Error("failed to decrypt notification secret", zap.String("target_id", target.ID.String()), zap.Error(err))
+			continue
+		}
+		delivery := &domain.NotificationDelivery{
+			TargetID: target.ID,
+			BuildID:  build.ID,
+			Status:   domain.DeliveryStatusPending,
+		}
+		if err := n.repo.CreateDelivery(ctx, delivery); err != nil {
+			log.Error("failed to record notification delivery", zap.Error(err))
+			continue
+		}
+		msg := &Message{
+			Event:      events.BuildFinished,
+			DeliveryID: delivery.ID,
+			Project:    project,
+			Build:      build,
+			URL:        n.publicURL + "/builds/" + build.ID.String(),
+		}
+
+		n.wg.Add(1)
+		go func(target *domain.NotificationTarget) {
+			defer n.wg.Done()
+			n.deliver(target, secret, msg, delivery)
+		}(target)
+	}
+}
+
+// deliver sends msg, retrying with backoff, and records each attempt.
+func (n *Notifier) deliver(target *domain.NotificationTarget, secret string, msg *Message, d *domain.NotificationDelivery) {
+	log := zap.L().With(zap.String("delivery_id", d.ID.String()), zap.String("target_id", target.ID.String()))
+	sender, ok := n.senders[target.Kind]
+	if !ok {
+		d.Status = domain.DeliveryStatusFailed
+		d.Error = "unknown target kind " + string(target.Kind)
+		n.record(d, log)
+		return
+	}
+
+	for {
+		d.Attempts++
+		code, err := sender.Send(n.ctx, target, secret, msg)
+		if code != 0 {
+			d.ResponseCode = &code
+		}
+		if err == nil {
+			d.Status = domain.DeliveryStatusDelivered
+			d.Error = ""
+			n.record(d, log)
+			return
+		}
+
+		d.Error = err.Error()
+		if !retryable(err) || d.Attempts > len(n.delays) {
+			d.Status = domain.DeliveryStatusFailed
+			n.record(d, log)
+			return
+		}
+		n.record(d, log)
+
+		select {
+		case <-n.ctx.Done():
+			d.Status = domain.DeliveryStatusFailed
+			d.Error = "gave up on shutdown after: " + d.Error
+			n.record(d, log)
+			return
+		case <-time.After(n.delays[d.Attempts-1]):
+		}
+	}
+}
+
+func (n *Notifier) record(d *domain.NotificationDelivery, log *zap.Logger) {
+	if err := n.repo.UpdateDelivery(context.Background(), d); err != nil {
+		log.Error("failed to update notification delivery", zap.Error(err))
+	}
+}
+
+// Close waits up to timeout for deliveries in progress, then abandons their
+// remaining retries. Abandoned deliveries are recorded as FAILED; retries are
+// kept in memory only, so nothing resumes them after a restart.
+func (n *Notifier) Close(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		n.cancel()
+		<-done
+	}
+	n.cancel()
+}
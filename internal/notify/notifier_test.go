@@ -0,0 +1,172 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/princetheprogrammerbtw/nanoci/internal/config"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"github.com/princetheprogrammerbtw/nanoci/pkg/crypto"
+)
+
+const testKey = "0123456789abcdef0123456789abcdef"
+
+type fakeNotificationRepo struct {
+	domain.NotificationRepository
+	mu         sync.Mutex
+	targets    []*domain.NotificationTarget
+	deliveries []*domain.NotificationDelivery
+}
+
+func (r *fakeNotificationRepo) ListTargetsByProjectID(ctx context.Context, projectID uuid.UUID) ([]*domain.NotificationTarget, error) {
+	return r.targets, nil
+}
+
+func (r *fakeNotificationRepo) CreateDelivery(ctx context.Context, d *domain.NotificationDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d.ID = uuid.New()
+	r.deliveries = append(r.deliveries, d)
+	return nil
+}
+
+func (r *fakeNotificationRepo) UpdateDelivery(ctx context.Context, d *domain.NotificationDelivery) error {
+	return nil
+}
+
+type fakeBuildRepo struct {
+	domain.BuildRepository
+	previous *domain.Build
+}
+
+func (r *fakeBuildRepo) GetPrevious(ctx context.Context, b *domain.Build) (*domain.Build, error) {
+	return r.previous, nil
+}
+
+type fakeProjectRepo struct {
+	domain.ProjectRepository
+}
+
+func (r *fakeProjectRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Project, error) {
+	return &domain.Project{ID: id, Name: "api"}, nil
+}
+
+func newTestNotifier(t *testing.T, repo *fakeNotificationRepo, previous *domain.Build) *Notifier {
+	t.Helper()
+	n := NewNotifier(repo, &fakeBuildRepo{previous: previous}, &fakeProjectRepo{}, &config.Config{
+		EncryptionKey: testKey,
+		PublicURL:     "https://ci.example.com/",
+	})
+	n.delays = []time.Duration{0, 0, 0}
+	return n
+}
+
+func target(t *testing.T, kind domain.NotificationKind, url string, on domain.NotifyOn) *domain.NotificationTarget {
+	t.Helper()
+	secret, err := crypto.Encrypt("s3cret", []byte(testKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &domain.NotificationTarget{ID: uuid.New(), Kind: kind, URL: url, On: on, EncryptedSecret: secret}
+}
+
+func TestNotifyRetriesAndSigns(t *testing.T) {
+	var calls atomic.Int32
+	var got Message
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if sig := r.Header.Get(SignatureHeader); sig != Sign("s3cret", body) {
+			t.Errorf("Unexpected signature %q", sig)
+		}
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("Invalid body: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	repo := &fakeNotificationRepo{targets: []*domain.NotificationTarget{target(t, domain.NotificationKindWebhook, srv.URL, domain.NotifyAlways)}}
+	n := newTestNotifier(t, repo, nil)
+	build := &domain.Build{ID: uuid.New(), Branch: "main", Status: domain.BuildStatusFailed}
+	n.Notify(context.Background(), build)
+	n.Close(5 * time.Second)
+
+	if len(repo.deliveries) != 1 {
+		t.Fatalf("Expected 1 delivery, got %d", len(repo.deliveries))
+	}
+	d := repo.deliveries[0]
+	if d.Status != domain.DeliveryStatusDelivered || d.Attempts != 3 || d.ResponseCode == nil || *d.ResponseCode != http.StatusOK {
+		t.Errorf("Unexpected delivery: %+v", d)
+	}
+	if got.Build == nil || got.Build.ID != build.ID || got.Project.Name != "api" {
+		t.Errorf("Unexpected message: %+v", got)
+	}
+	if want := "https://ci.example.com/builds/" + build.ID.String(); got.URL != want {
+		t.Errorf("Expected URL %s, got %s", want, got.URL)
+	}
+}
+
+func TestNotifyStopsOnClientError(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	repo := &fakeNotificationRepo{targets: []*domain.NotificationTarget{target(t, domain.NotificationKindSlack, srv.URL, domain.NotifyAlways)}}
+	n := newTestNotifier(t, repo, nil)
+	n.Notify(context.Background(), &domain.Build{ID: uuid.New(), Status: domain.BuildStatusSuccess})
+	n.Close(5 * time.Second)
+
+	if calls.Load() != 1 {
+		t.Errorf("Expected a single attempt, got %d", calls.Load())
+	}
+	if d := repo.deliveries[0]; d.Status != domain.DeliveryStatusFailed {
+		t.Errorf("Expected FAILED delivery, got %+v", d)
+	}
+}
+
+func TestNotifyFilters(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer srv.Close()
+
+	repo := &fakeNotificationRepo{targets: []*domain.NotificationTarget{
+		target(t, domain.NotificationKindWebhook, srv.URL, domain.NotifyChange),
+		target(t, domain.NotificationKindWebhook, srv.URL, domain.NotifyFailure),
+	}}
+	n := newTestNotifier(t, repo, &domain.Build{Status: domain.BuildStatusSuccess})
+	n.Notify(context.Background(), &domain.Build{ID: uuid.New(), Status: domain.BuildStatusSuccess})
+
+	parent := uuid.New()
+	n.Notify(context.Background(), &domain.Build{ID: uuid.New(), ParentID: &parent, Status: domain.BuildStatusFailed})
+	n.Close(5 * time.Second)
+
+	if len(repo.deliveries) != 0 || calls.Load() != 0 {
+		t.Errorf("Expected no deliveries, got %d", len(repo.deliveries))
+	}
+}
+
+func TestMessageSummary(t *testing.T) {
+	m := &Message{
+		Project: Project{Name: "api"},
+		Build:   &domain.Build{Branch: "main", Status: domain.BuildStatusFailed, CommitHash: "1a2b3c4d5e6f", CommitMessage: "Fix login\n\nDetails"},
+	}
+	if got, want := m.Summary(), "nanoci: api build on main failed (1a2b3c4 Fix login)"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
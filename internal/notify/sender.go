@@ -0,0 +1,162 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+)
+
+// Headers set on every HTTP delivery. The signature lets a receiver check
+// that a delivery came from NanoCI with the target's secret.
+const (
+	SignatureHeader = "X-NanoCI-Signature-256"
+	EventHeader     = "X-NanoCI-Event"
+	DeliveryHeader  = "X-NanoCI-Delivery"
+)
+
+const httpTimeout = 10 * time.Second
+
+// Sender delivers a message to one kind of target. It returns the HTTP
+// status code of the response, if there was one.
+type Sender interface {
+	Send(ctx context.Context, target *domain.NotificationTarget, secret string, msg *Message) (int, error)
+}
+
+// permanentError marks a failure that retrying cannot fix.
+type permanentError struct {
+	error
+}
+
+func retryable(err error) bool {
+	var p permanentError
+	return !errors.As(err, &p)
+}
+
+// Sign returns the signature of body sent in SignatureHeader.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// post sends body as signed JSON. Client errors other than 408 and 429 are
+// permanent.
+func post(ctx context.Context, client *http.Client, url, secret string, msg *Message, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "NanoCI")
+	req.Header.Set(EventHeader, string(msg.Event))
+	req.Header.Set(DeliveryHeader, msg.DeliveryID.String())
+	req.Header.Set(SignatureHeader, Sign(secret, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch code := resp.StatusCode; {
+	case code >= 200 && code < 300:
+		return code, nil
+	case code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500:
+		return code, fmt.Errorf("unexpected response %s", resp.Status)
+	default:
+		return code, permanentError{fmt.Errorf("unexpected response %s", resp.Status)}
+	}
+}
+
+// WebhookSender posts the message itself as JSON.
+type WebhookSender struct {
+	client *http.Client
+}
+
+func NewWebhookSender() *WebhookSender {
+	return &WebhookSender{client: &http.Client{Timeout: httpTimeout}}
+}
+
+func (s *WebhookSender) Send(ctx context.Context, target *domain.NotificationTarget, secret string, msg *Message) (int, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return 0, permanentError{err}
+	}
+	return post(ctx, s.client, target.URL, secret, msg, body)
+}
+
+// SlackSender posts {"text": ...}, the payload Slack incoming webhooks take
+// and that Mattermost, Teams and Discord's /slack endpoint also accept.
+type SlackSender struct {
+	client *http.Client
+}
+
+func NewSlackSender() *SlackSender {
+	return &SlackSender{client: &http.Client{Timeout: httpTimeout}}
+}
+
+func (s *SlackSender) Send(ctx context.Context, target *domain.NotificationTarget, secret string, msg *Message) (int, error) {
+	body, err := json.Marshal(map[string]string{"text": msg.Summary() + "\n" + msg.URL})
+	if err != nil {
+		return 0, permanentError{err}
+	}
+	return post(ctx, s.client, target.URL, secret, msg, body)
+}
+
+// EmailSender mails the recipients through an SMTP server, authenticating
+// when a username is set.
+type EmailSender struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+}
+
+func NewEmailSender(host string, port int, username, password, from string) *EmailSender {
+	return &EmailSender{host: host, port: port, username: username, password: password, from: from}
+}
+
+func (s *EmailSender) Send(ctx context.Context, target *domain.NotificationTarget, secret string, msg *Message) (int, error) {
+	if s.host == "" {
+		return 0, permanentError{errors.New("SMTP_HOST is not configured")}
+	}
+
+	var auth smtp.Auth
+	if s.username != "" {
+		auth = smtp.PlainAuth("", s.username, s.password, s.host)
+	}
+
+	addr := s.host + ":" + strconv.Itoa(s.port)
+	return 0, smtp.SendMail(addr, auth, s.from, target.Recipients, s.mail(target.Recipients, msg))
+}
+
+// mail renders the email for msg. The summary carries the commit message,
+// branch and project name, so line breaks are dropped from the subject
+// before it is encoded, keeping it from adding headers of its own.
+func (s *EmailSender) mail(recipients []string, msg *Message) []byte {
+	summary := msg.Summary()
+	subject := strings.NewReplacer("\r", "", "\n", "").Replace(summary)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "%s: %s\r\n", DeliveryHeader, msg.DeliveryID)
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&b, "%s\r\n\r\n%s\r\n", summary, msg.URL)
+	return []byte(b.String())
+}
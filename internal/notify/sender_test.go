@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"bytes"
+	"mime"
+	"net/mail"
+	"testing"
+
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+)
+
+func TestEmailSubject(t *testing.T) {
+	tests := []struct {
+		name    string
+		branch  string
+		commit  string
+		subject string
+	}{
+		{"line breaks", "main\r\nBcc: attacker@example.com", "Fix login\r\n", "nanoci: api build on mainBcc: attacker@example.com failed (1a2b3c4 Fix login)"},
+		{"non-ASCII", "main", "Corrige la connexion café ☕", "nanoci: api build on main failed (1a2b3c4 Corrige la connexion café ☕)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewEmailSender("smtp.example.com", 25, "", "", "ci@example.com")
+			m := &Message{
+				Project: Project{Name: "api"},
+				Build:   &domain.Build{Branch: tt.branch, Status: domain.BuildStatusFailed, CommitHash: "1a2b3c4d5e6f", CommitMessage: tt.commit},
+			}
+
+			parsed, err := mail.ReadMessage(bytes.NewReader(s.mail([]string{"dev@example.com"}, m)))
+			if err != nil {
+				t.Fatalf("Expected a valid email, got %v", err)
+			}
+			if bcc := parsed.Header.Get("Bcc"); bcc != "" {
+				t.Errorf("Expected no Bcc header, got %q", bcc)
+			}
+			raw := parsed.Header.Get("Subject")
+			for _, c := range raw {
+				if c > 127 {
+					t.Fatalf("Expected an ASCII subject header, got %q", raw)
+				}
+			}
+			subject, err := new(mime.WordDecoder).DecodeHeader(raw)
+			if err != nil {
+				t.Fatalf("Expected a decodable subject, got %v", err)
+			}
+			if subject != tt.subject {
+				t.Errorf("Expected subject %q, got %q", tt.subject, subject)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+
+	"go.uber.org/zap"
+)
+
+const controlChannel = "nanoci:control"
+
+const ActionCancel = "cancel"
+
+// ControlMessage is broadcast to every worker; the worker running BuildID acts on it.
+type ControlMessage struct {
+	Action  string `json:"action"`
+	BuildID string `json:"build_id"`
+}
+
+// Remove deletes any queued jobs for buildID, reporting whether one was found.
+func (q *RedisQueue) Remove(ctx context.Context, buildID string) (bool, error) {
+	jobs, err := q.client.LRange(ctx, jobsKey, 0, -1).Result()
+	if err != nil {
+		return false, err
+	}
+
+	removed := false
+	for _, raw := range jobs {
+		var job Job
+		if err := json.Unmarshal([]byte(raw), &job); err != nil || job.BuildID != buildID {
+			continue
+		}
+		n, err := q.client.LRem(ctx, jobsKey, 0, raw).Result()
+		if err != nil {
+			return removed, err
+		}
+		removed = removed || n > 0
+	}
+	return removed, nil
+}
+
+// Cancel asks whichever worker is running buildID to stop it.
+func (q *RedisQueue) Cancel(ctx context.Context, buildID string) error {
+	data, err := json.Marshal(ControlMessage{Action: ActionCancel, BuildID: buildID})
+	if err != nil {
+		return err
+	}
+	return q.client.Publish(ctx, controlChannel, data).Err()
+}
+
+// Control streams control messages until ctx is done.
+func (q *RedisQueue) Control(ctx context.Context) <-chan ControlMessage {
+	out := make(chan ControlMessage)
+	go func() {
+		defer close(out)
+
+		pubsub := q.client.Subscribe(ctx, controlChannel)
+		defer pubsub.Close()
+
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				var cm ControlMessage
+				if err := json.Unmarshal([]byte(msg.Payload), &cm); err != nil {
+					zap.L().Error("invalid control message", zap.Error(err))
+					continue
+				}
+				select {
+				case out <- cm:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
@@ -3,12 +3,32 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+const (
+	jobsKey       = "nanoci:jobs"
+	workersKey    = "nanoci:workers"
+	processingKey = "nanoci:processing:%s"
+	heartbeatKey  = "nanoci:heartbeat:%s"
+)
+
 type Job struct {
-	BuildID string `json:"build_id"`
+	BuildID  string `json:"build_id"`
+	Attempts int    `json:"attempts,omitempty"`
+}
+
+// Delivery is a job that has been moved into a worker's processing list.
+// It stays there until it is acknowledged or negatively acknowledged, so a
+// crashed worker never loses it.
+type Delivery struct {
+	Job      *Job
+	WorkerID string
+	raw      string
 }
 
 type RedisQueue struct {
@@ -25,9 +45,124 @@ func (q *RedisQueue) Enqueue(ctx context.Context, job *Job) error {
 		return err
 	}
 
-	return q.client.LPush(ctx, "nanoci:jobs", data).Err()
+	return q.client.LPush(ctx, jobsKey, data).Err()
+}
+
+// Dequeue blocks for up to timeout waiting for a job and atomically moves it
+// into workerID's processing list. It returns nil when no job arrived.
+func (q *RedisQueue) Dequeue(ctx context.Context, workerID string, timeout time.Duration) (*Delivery, error) {
+	raw, err := q.client.BLMove(ctx, jobsKey, processing(workerID), "RIGHT", "LEFT", timeout).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decode(raw, workerID)
+}
+
+// Ack removes a finished job from the worker's processing list.
+func (q *RedisQueue) Ack(ctx context.Context, d *Delivery) error {
+	return q.client.LRem(ctx, processing(d.WorkerID), 1, d.raw).Err()
+}
+
+// Nack puts a job back at the head of the queue with its attempt count bumped.
+func (q *RedisQueue) Nack(ctx context.Context, d *Delivery) error {
+	job := *d.Job
+	job.Attempts++
+	data, err := json.Marshal(&job)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LRem(ctx, processing(d.WorkerID), 1, d.raw)
+		pipe.RPush(ctx, jobsKey, data)
+		return nil
+	})
+	return err
+}
+
+// Heartbeat registers workerID as alive for ttl.
+func (q *RedisQueue) Heartbeat(ctx context.Context, workerID string, ttl time.Duration) error {
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, workersKey, workerID)
+		pipe.Set(ctx, heartbeat(workerID), time.Now().Unix(), ttl)
+		return nil
+	})
+	return err
+}
+
+// Deregister removes a cleanly stopped worker. Workers that still hold jobs
+// are left registered so the reaper recovers them once the heartbeat lapses.
+func (q *RedisQueue) Deregister(ctx context.Context, workerID string) error {
+	n, err := q.client.LLen(ctx, processing(workerID)).Result()
+	if err != nil || n > 0 {
+		return err
+	}
+	return q.Forget(ctx, workerID)
+}
+
+// ExpiredWorkers lists registered workers whose heartbeat has lapsed.
+func (q *RedisQueue) ExpiredWorkers(ctx context.Context) ([]string, error) {
+	workers, err := q.client.SMembers(ctx, workersKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []string
+	for _, w := range workers {
+		n, err := q.client.Exists(ctx, heartbeat(w)).Result()
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			expired = append(expired, w)
+		}
+	}
+	return expired, nil
+}
+
+// Claim moves one job from a dead worker's processing list into workerID's,
+// so the claimant can requeue or fail it without risk of losing it. It
+// returns nil once the dead worker's list is empty.
+func (q *RedisQueue) Claim(ctx context.Context, deadWorkerID, workerID string) (*Delivery, error) {
+	raw, err := q.client.LMove(ctx, processing(deadWorkerID), processing(workerID), "RIGHT", "LEFT").Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decode(raw, workerID)
+}
+
+// Forget drops a worker from the registry.
+func (q *RedisQueue) Forget(ctx context.Context, workerID string) error {
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SRem(ctx, workersKey, workerID)
+		pipe.Del(ctx, heartbeat(workerID))
+		return nil
+	})
+	return err
 }
 
 func (q *RedisQueue) Close() error {
 	return q.client.Close()
 }
+
+func decode(raw, workerID string) (*Delivery, error) {
+	d := &Delivery{Job: &Job{}, WorkerID: workerID, raw: raw}
+	if err := json.Unmarshal([]byte(raw), d.Job); err != nil {
+		return d, fmt.Errorf("invalid job payload: %w", err)
+	}
+	return d, nil
+}
+
+func processing(workerID string) string {
+	return fmt.Sprintf(processingKey, workerID)
+}
+
+func heartbeat(workerID string) string {
+	return fmt.Sprintf(heartbeatKey, workerID)
+}
@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+)
+
+type artifactRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewArtifactRepository(pool *pgxpool.Pool) domain.ArtifactRepository {
+	return &artifactRepository{pool: pool}
+}
+
+// Create records an artifact, replacing one the build already stored under
+// the same path, e.g. by an interrupted earlier attempt.
+func (r *artifactRepository) Create(ctx context.Context, a *domain.Artifact) error {
+	query := `
+		INSERT INTO artifacts (build_id, path, size, digest, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (build_id, path) DO UPDATE
+		SET size = EXCLUDED.size, digest = EXCLUDED.digest, expires_at = EXCLUDED.expires_at
+		RETURNING id, created_at
+	`
+	return r.pool.QueryRow(ctx, query, a.BuildID, a.Path, a.Size, a.Digest, a.ExpiresAt).Scan(&a.ID, &a.CreatedAt)
+}
+
+func (r *artifactRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Artifact, error) {
+	query := `SELECT id, build_id, path, size, digest, expires_at, created_at FROM artifacts WHERE id = $1`
+	var a domain.Artifact
+	err := r.pool.QueryRow(ctx, query, id).Scan(&a.ID, &a.BuildID, &a.Path, &a.Size, &a.Digest, &a.ExpiresAt, &a.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *artifactRepository) ListByBuildID(ctx context.Context, buildID uuid.UUID) ([]*domain.Artifact, error) {
+	query := `SELECT id, build_id, path, size, digest, expires_at, created_at
+			  FROM artifacts WHERE build_id = $1 ORDER BY path`
+	rows, err := r.pool.Query(ctx, query, buildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var artifacts []*domain.Artifact
+	for rows.Next() {
+		var a domain.Artifact
+		if err := rows.Scan(&a.ID, &a.BuildID, &a.Path, &a.Size, &a.Digest, &a.ExpiresAt, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, &a)
+	}
+	return artifacts, nil
+}
+
+func (r *artifactRepository) DeleteExpired(ctx context.Context, t time.Time) ([]string, error) {
+	query := `
+		WITH expired AS (
+			DELETE FROM artifacts WHERE expires_at < $1 RETURNING digest
+		)
+		SELECT DISTINCT digest FROM expired
+		WHERE digest NOT IN (SELECT digest FROM artifacts WHERE expires_at >= $1)
+	`
+	rows, err := r.pool.Query(ctx, query, t)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var digests []string
+	for rows.Next() {
+		var d string
+		if err := rows.Scan(&d); err != nil {
+			return nil, err
+		}
+		digests = append(digests, d)
+	}
+	return digests, rows.Err()
+}
@@ -9,6 +9,9 @@ import (
 	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
 )
 
+const buildColumns = `id, project_id, commit_hash, commit_message, branch, tag, event, changed_files,
+			  pr_number, source_branch, checkout_ref, fork, parent_id, matrix, status, cancel_requested, started_at, finished_at, created_at`
+
 type buildRepository struct {
 	pool *pgxpool.Pool
 }
@@ -18,12 +21,20 @@ func NewBuildRepository(pool *pgxpool.Pool) domain.BuildRepository {
 }
 
 func (r *buildRepository) Create(ctx context.Context, b *domain.Build) error {
+	if b.Event == "" {
+		b.Event = domain.BuildEventPush
+	}
+	if b.ChangedFiles == nil {
+		b.ChangedFiles = []string{}
+	}
 	query := `
-		INSERT INTO builds (project_id, commit_hash, commit_message, branch, status)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO builds (project_id, commit_hash, commit_message, branch, tag, event, changed_files,
+			pr_number, source_branch, checkout_ref, fork, parent_id, matrix, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 		RETURNING id, created_at
 	`
-	return r.pool.QueryRow(ctx, query, b.ProjectID, b.CommitHash, b.CommitMessage, b.Branch, b.Status).
+	return r.pool.QueryRow(ctx, query, b.ProjectID, b.CommitHash, b.CommitMessage, b.Branch, b.Tag, b.Event, b.ChangedFiles,
+		b.PRNumber, b.SourceBranch, b.CheckoutRef, b.Fork, b.ParentID, b.Matrix, b.Status).
 		Scan(&b.ID, &b.CreatedAt)
 }
 
@@ -37,22 +48,61 @@ func (r *buildRepository) Update(ctx context.Context, b *domain.Build) error {
 	return err
 }
 
+func (r *buildRepository) UpdateStatus(ctx context.Context, b *domain.Build, from domain.BuildStatus) (bool, error) {
+	query := `
+		UPDATE builds
+		SET status = $1, started_at = $2, finished_at = $3
+		WHERE id = $4 AND status = $5
+	`
+	tag, err := r.pool.Exec(ctx, query, b.Status, b.StartedAt, b.FinishedAt, b.ID, from)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *buildRepository) RequestCancel(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE builds SET cancel_requested = true WHERE id = $1`
+	_, err := r.pool.Exec(ctx, query, id)
+	return err
+}
+
 func (r *buildRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Build, error) {
-	query := `SELECT id, project_id, commit_hash, commit_message, branch, status, started_at, finished_at, created_at 
-			  FROM builds WHERE id = $1`
-	var b domain.Build
-	err := r.pool.QueryRow(ctx, query, id).
-		Scan(&b.ID, &b.ProjectID, &b.CommitHash, &b.CommitMessage, &b.Branch, &b.Status, &b.StartedAt, &b.FinishedAt, &b.CreatedAt)
+	query := `SELECT ` + buildColumns + ` FROM builds WHERE id = $1`
+	b, err := scanBuild(r.pool.QueryRow(ctx, query, id))
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
-	return &b, err
+	return b, err
 }
 
+// ListByProjectID lists a project's top-level builds; matrix children are
+// listed through their parent.
 func (r *buildRepository) ListByProjectID(ctx context.Context, projectID uuid.UUID) ([]*domain.Build, error) {
-	query := `SELECT id, project_id, commit_hash, commit_message, branch, status, started_at, finished_at, created_at 
-			  FROM builds WHERE project_id = $1 ORDER BY created_at DESC`
-	rows, err := r.pool.Query(ctx, query, projectID)
+	query := `SELECT ` + buildColumns + ` FROM builds WHERE project_id = $1 AND parent_id IS NULL ORDER BY created_at DESC`
+	return r.list(ctx, query, projectID)
+}
+
+func (r *buildRepository) ListByParentID(ctx context.Context, parentID uuid.UUID) ([]*domain.Build, error) {
+	query := `SELECT ` + buildColumns + ` FROM builds WHERE parent_id = $1 ORDER BY created_at`
+	return r.list(ctx, query, parentID)
+}
+
+func (r *buildRepository) GetPrevious(ctx context.Context, b *domain.Build) (*domain.Build, error) {
+	query := `SELECT ` + buildColumns + ` FROM builds
+			  WHERE project_id = $1 AND branch = $2 AND parent_id IS NULL AND created_at < $3
+			  AND event = $4 AND pr_number IS NOT DISTINCT FROM $5
+			  AND status IN ('SUCCESS', 'FAILED', 'TIMED_OUT')
+			  ORDER BY created_at DESC LIMIT 1`
+	prev, err := scanBuild(r.pool.QueryRow(ctx, query, b.ProjectID, b.Branch, b.CreatedAt, b.Event, b.PRNumber))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return prev, err
+}
+
+func (r *buildRepository) list(ctx context.Context, query string, args ...interface{}) ([]*domain.Build, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -60,11 +110,21 @@ func (r *buildRepository) ListByProjectID(ctx context.Context, projectID uuid.UU
 
 	var builds []*domain.Build
 	for rows.Next() {
-		var b domain.Build
-		if err := rows.Scan(&b.ID, &b.ProjectID, &b.CommitHash, &b.CommitMessage, &b.Branch, &b.Status, &b.StartedAt, &b.FinishedAt, &b.CreatedAt); err != nil {
+		b, err := scanBuild(rows)
+		if err != nil {
 			return nil, err
 		}
-		builds = append(builds, &b)
+		builds = append(builds, b)
 	}
 	return builds, nil
 }
+
+func scanBuild(row pgx.Row) (*domain.Build, error) {
+	var b domain.Build
+	err := row.Scan(&b.ID, &b.ProjectID, &b.CommitHash, &b.CommitMessage, &b.Branch, &b.Tag, &b.Event, &b.ChangedFiles,
+		&b.PRNumber, &b.SourceBranch, &b.CheckoutRef, &b.Fork, &b.ParentID, &b.Matrix, &b.Status, &b.CancelRequested, &b.StartedAt, &b.FinishedAt, &b.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
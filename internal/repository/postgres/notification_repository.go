@@ -0,0 +1,103 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+)
+
+type notificationRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewNotificationRepository(pool *pgxpool.Pool) domain.NotificationRepository {
+	return &notificationRepository{pool: pool}
+}
+
+func (r *notificationRepository) CreateTarget(ctx context.Context, t *domain.NotificationTarget) error {
+	if t.Recipients == nil {
+		t.Recipients = []string{}
+	}
+	if t.Branches == nil {
+		t.Branches = []string{}
+	}
+	query := `
+		INSERT INTO notification_targets (project_id, kind, url, recipients, notify_on, branches, pull_requests, encrypted_secret)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`
+	return r.pool.QueryRow(ctx, query, t.ProjectID, t.Kind, t.URL, t.Recipients, t.On, t.Branches, t.PullRequests, t.EncryptedSecret).
+		Scan(&t.ID, &t.CreatedAt)
+}
+
+func (r *notificationRepository) ListTargetsByProjectID(ctx context.Context, projectID uuid.UUID) ([]*domain.NotificationTarget, error) {
+	query := `SELECT id, project_id, kind, url, recipients, notify_on, branches, pull_requests, encrypted_secret, created_at
+			  FROM notification_targets WHERE project_id = $1 ORDER BY created_at`
+	rows, err := r.pool.Query(ctx, query, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var targets []*domain.NotificationTarget
+	for rows.Next() {
+		var t domain.NotificationTarget
+		if err := rows.Scan(&t.ID, &t.ProjectID, &t.Kind, &t.URL, &t.Recipients, &t.On, &t.Branches,
+			&t.PullRequests, &t.EncryptedSecret, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		targets = append(targets, &t)
+	}
+	return targets, rows.Err()
+}
+
+func (r *notificationRepository) DeleteTarget(ctx context.Context, projectID, id uuid.UUID) error {
+	query := `DELETE FROM notification_targets WHERE project_id = $1 AND id = $2`
+	_, err := r.pool.Exec(ctx, query, projectID, id)
+	return err
+}
+
+func (r *notificationRepository) CreateDelivery(ctx context.Context, d *domain.NotificationDelivery) error {
+	query := `
+		INSERT INTO notification_deliveries (target_id, build_id, status)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, updated_at
+	`
+	return r.pool.QueryRow(ctx, query, d.TargetID, d.BuildID, d.Status).Scan(&d.ID, &d.CreatedAt, &d.UpdatedAt)
+}
+
+func (r *notificationRepository) UpdateDelivery(ctx context.Context, d *domain.NotificationDelivery) error {
+	query := `
+		UPDATE notification_deliveries
+		SET status = $1, attempts = $2, response_code = $3, error = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $5
+		RETURNING updated_at
+	`
+	return r.pool.QueryRow(ctx, query, d.Status, d.Attempts, d.ResponseCode, d.Error, d.ID).Scan(&d.UpdatedAt)
+}
+
+func (r *notificationRepository) ListDeliveriesByProjectID(ctx context.Context, projectID uuid.UUID, limit int) ([]*domain.NotificationDelivery, error) {
+	query := `SELECT d.id, d.target_id, d.build_id, d.status, d.attempts, d.response_code, d.error, d.created_at, d.updated_at
+			  FROM notification_deliveries d
+			  JOIN notification_targets t ON t.id = d.target_id
+			  WHERE t.project_id = $1
+			  ORDER BY d.created_at DESC LIMIT $2`
+	rows, err := r.pool.Query(ctx, query, projectID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*domain.NotificationDelivery
+	for rows.Next() {
+		var d domain.NotificationDelivery
+		if err := rows.Scan(&d.ID, &d.TargetID, &d.BuildID, &d.Status, &d.Attempts, &d.ResponseCode, &d.Error,
+			&d.CreatedAt, &d.UpdatedAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &d)
+	}
+	return deliveries, rows.Err()
+}
@@ -9,6 +9,9 @@ import (
 	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
 )
 
+const projectColumns = `id, user_id, name, repo_url, provider, repo_id, default_branch, webhook_secret,
+			  credential_type, encrypted_credential, created_at, updated_at`
+
 type projectRepository struct {
 	pool *pgxpool.Pool
 }
@@ -19,41 +22,34 @@ func NewProjectRepository(pool *pgxpool.Pool) domain.ProjectRepository {
 
 func (r *projectRepository) Create(ctx context.Context, p *domain.Project) error {
 	query := `
-		INSERT INTO projects (user_id, name, repo_url, github_repo_id, default_branch, webhook_secret)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO projects (user_id, name, repo_url, provider, repo_id, default_branch, webhook_secret, credential_type, encrypted_credential)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id, created_at, updated_at
 	`
-	return r.pool.QueryRow(ctx, query, p.UserID, p.Name, p.RepoURL, p.GithubRepoID, p.DefaultBranch, p.WebhookSecret).
+	return r.pool.QueryRow(ctx, query, p.UserID, p.Name, p.RepoURL, p.Provider, p.RepoID, p.DefaultBranch, p.WebhookSecret, p.CredentialType, p.EncryptedCredential).
 		Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt)
 }
 
 func (r *projectRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Project, error) {
-	query := `SELECT id, user_id, name, repo_url, github_repo_id, default_branch, webhook_secret, created_at, updated_at 
-			  FROM projects WHERE id = $1`
-	var p domain.Project
-	err := r.pool.QueryRow(ctx, query, id).
-		Scan(&p.ID, &p.UserID, &p.Name, &p.RepoURL, &p.GithubRepoID, &p.DefaultBranch, &p.WebhookSecret, &p.CreatedAt, &p.UpdatedAt)
+	query := `SELECT ` + projectColumns + ` FROM projects WHERE id = $1`
+	p, err := scanProject(r.pool.QueryRow(ctx, query, id))
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
-	return &p, err
+	return p, err
 }
 
-func (r *projectRepository) GetByGithubRepoID(ctx context.Context, githubRepoID string) (*domain.Project, error) {
-	query := `SELECT id, user_id, name, repo_url, github_repo_id, default_branch, webhook_secret, created_at, updated_at 
-			  FROM projects WHERE github_repo_id = $1`
-	var p domain.Project
-	err := r.pool.QueryRow(ctx, query, githubRepoID).
-		Scan(&p.ID, &p.UserID, &p.Name, &p.RepoURL, &p.GithubRepoID, &p.DefaultBranch, &p.WebhookSecret, &p.CreatedAt, &p.UpdatedAt)
+func (r *projectRepository) GetByRepoID(ctx context.Context, provider domain.SCMProvider, repoID string) (*domain.Project, error) {
+	query := `SELECT ` + projectColumns + ` FROM projects WHERE provider = $1 AND repo_id = $2`
+	p, err := scanProject(r.pool.QueryRow(ctx, query, provider, repoID))
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
-	return &p, err
+	return p, err
 }
 
 func (r *projectRepository) ListByUserID(ctx context.Context, userID uuid.UUID) ([]*domain.Project, error) {
-	query := `SELECT id, user_id, name, repo_url, github_repo_id, default_branch, webhook_secret, created_at, updated_at 
-			  FROM projects WHERE user_id = $1`
+	query := `SELECT ` + projectColumns + ` FROM projects WHERE user_id = $1`
 	rows, err := r.pool.Query(ctx, query, userID)
 	if err != nil {
 		return nil, err
@@ -62,11 +58,41 @@ func (r *projectRepository) ListByUserID(ctx context.Context, userID uuid.UUID)
 
 	var projects []*domain.Project
 	for rows.Next() {
-		var p domain.Project
-		if err := rows.Scan(&p.ID, &p.UserID, &p.Name, &p.RepoURL, &p.GithubRepoID, &p.DefaultBranch, &p.WebhookSecret, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		p, err := scanProject(rows)
+		if err != nil {
 			return nil, err
 		}
-		projects = append(projects, &p)
+		projects = append(projects, p)
 	}
 	return projects, nil
 }
+
+func (r *projectRepository) UpdateCredential(ctx context.Context, p *domain.Project) error {
+	query := `
+		UPDATE projects
+		SET credential_type = $1, encrypted_credential = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+		RETURNING updated_at
+	`
+	return r.pool.QueryRow(ctx, query, p.CredentialType, p.EncryptedCredential, p.ID).Scan(&p.UpdatedAt)
+}
+
+func (r *projectRepository) UpdateWebhookSecret(ctx context.Context, p *domain.Project) error {
+	query := `
+		UPDATE projects
+		SET webhook_secret = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+		RETURNING updated_at
+	`
+	return r.pool.QueryRow(ctx, query, p.WebhookSecret, p.ID).Scan(&p.UpdatedAt)
+}
+
+func scanProject(row pgx.Row) (*domain.Project, error) {
+	var p domain.Project
+	err := row.Scan(&p.ID, &p.UserID, &p.Name, &p.RepoURL, &p.Provider, &p.RepoID, &p.DefaultBranch, &p.WebhookSecret,
+		&p.CredentialType, &p.EncryptedCredential, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+)
+
+type stepRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewStepRepository(pool *pgxpool.Pool) domain.StepRepository {
+	return &stepRepository{pool: pool}
+}
+
+func (r *stepRepository) Create(ctx context.Context, s *domain.BuildStep) error {
+	query := `
+		INSERT INTO steps (build_id, name, position, status)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+	return r.pool.QueryRow(ctx, query, s.BuildID, s.Name, s.Position, s.Status).Scan(&s.ID)
+}
+
+func (r *stepRepository) Update(ctx context.Context, s *domain.BuildStep) error {
+	query := `
+		UPDATE steps
+		SET status = $1, exit_code = $2, started_at = $3, finished_at = $4
+		WHERE id = $5
+	`
+	_, err := r.pool.Exec(ctx, query, s.Status, s.ExitCode, s.StartedAt, s.FinishedAt, s.ID)
+	return err
+}
+
+func (r *stepRepository) ListByBuildID(ctx context.Context, buildID uuid.UUID) ([]*domain.BuildStep, error) {
+	query := `SELECT id, build_id, name, position, status, exit_code, started_at, finished_at
+			  FROM steps WHERE build_id = $1 ORDER BY position`
+	rows, err := r.pool.Query(ctx, query, buildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var steps []*domain.BuildStep
+	for rows.Next() {
+		var s domain.BuildStep
+		if err := rows.Scan(&s.ID, &s.BuildID, &s.Name, &s.Position, &s.Status, &s.ExitCode, &s.StartedAt, &s.FinishedAt); err != nil {
+			return nil, err
+		}
+		steps = append(steps, &s)
+	}
+	return steps, nil
+}
+
+func (r *stepRepository) DeleteByBuildID(ctx context.Context, buildID uuid.UUID) error {
+	query := `DELETE FROM steps WHERE build_id = $1`
+	_, err := r.pool.Exec(ctx, query, buildID)
+	return err
+}
@@ -0,0 +1,114 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+)
+
+type webhookDeliveryRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewWebhookDeliveryRepository(pool *pgxpool.Pool) domain.WebhookDeliveryRepository {
+	return &webhookDeliveryRepository{pool: pool}
+}
+
+func (r *webhookDeliveryRepository) Create(ctx context.Context, d *domain.WebhookDelivery) (bool, error) {
+	query := `
+		INSERT INTO webhook_deliveries (project_id, delivery_id, event, payload_hash, payload, outcome, error, build_id, redelivery_of)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (project_id, delivery_id) WHERE delivery_id <> '' DO NOTHING
+		RETURNING id, created_at
+	`
+	err := r.pool.QueryRow(ctx, query, d.ProjectID, d.DeliveryID, d.Event, d.PayloadHash, d.Payload, d.Outcome, d.Error,
+		d.BuildID, d.RedeliveryOf).Scan(&d.ID, &d.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+const webhookDeliveryColumns = `id, project_id, delivery_id, event, payload_hash, payload, outcome, error, build_id,
+				  redelivery_of, created_at`
+
+func (r *webhookDeliveryRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries WHERE id = $1`
+	d, err := scanWebhookDelivery(r.pool.QueryRow(ctx, query, id))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return d, err
+}
+
+func (r *webhookDeliveryRepository) GetByDeliveryID(ctx context.Context, projectID uuid.UUID, deliveryID string) (*domain.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries WHERE project_id = $1 AND delivery_id = $2`
+	d, err := scanWebhookDelivery(r.pool.QueryRow(ctx, query, projectID, deliveryID))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return d, err
+}
+
+func (r *webhookDeliveryRepository) Retry(ctx context.Context, id uuid.UUID, lease time.Duration) (bool, error) {
+	query := `
+		UPDATE webhook_deliveries
+		SET outcome = 'pending', error = '', attempted_at = NOW()
+		WHERE id = $1 AND (outcome = 'failed' OR (outcome = 'pending' AND attempted_at < NOW() - make_interval(secs => $2)))
+	`
+	tag, err := r.pool.Exec(ctx, query, id, lease.Seconds())
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *webhookDeliveryRepository) UpdateOutcome(ctx context.Context, d *domain.WebhookDelivery) error {
+	query := `UPDATE webhook_deliveries SET outcome = $1, error = $2, build_id = $3 WHERE id = $4`
+	_, err := r.pool.Exec(ctx, query, d.Outcome, d.Error, d.BuildID, d.ID)
+	return err
+}
+
+func (r *webhookDeliveryRepository) ListByProjectID(ctx context.Context, projectID uuid.UUID, limit int) ([]*domain.WebhookDelivery, error) {
+	query := `SELECT id, project_id, delivery_id, event, payload_hash, outcome, error, build_id, redelivery_of, created_at
+			  FROM webhook_deliveries WHERE project_id = $1
+			  ORDER BY created_at DESC LIMIT $2`
+	rows, err := r.pool.Query(ctx, query, projectID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*domain.WebhookDelivery
+	for rows.Next() {
+		var d domain.WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.ProjectID, &d.DeliveryID, &d.Event, &d.PayloadHash, &d.Outcome, &d.Error,
+			&d.BuildID, &d.RedeliveryOf, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (r *webhookDeliveryRepository) DeleteOlderThan(ctx context.Context, t time.Time) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM webhook_deliveries WHERE created_at < $1`, t)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func scanWebhookDelivery(row pgx.Row) (*domain.WebhookDelivery, error) {
+	var d domain.WebhookDelivery
+	err := row.Scan(&d.ID, &d.ProjectID, &d.DeliveryID, &d.Event, &d.PayloadHash, &d.Payload, &d.Outcome, &d.Error,
+		&d.BuildID, &d.RedeliveryOf, &d.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
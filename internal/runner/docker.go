@@ -2,15 +2,22 @@ package runner
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/client"
 	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"go.uber.org/zap"
 )
 
+const containerCleanupTimeout = 30 * time.Second
+
+// ErrStepTimeout is returned by RunStep when a step exceeds its timeout.
+var ErrStepTimeout = errors.New("step timed out")
+
 type DockerRunner struct {
 	cli *client.Client
 }
@@ -23,17 +30,18 @@ func NewDockerRunner() (*DockerRunner, error) {
 	return &DockerRunner{cli: cli}, nil
 }
 
-func (r *DockerRunner) RunStep(ctx context.Context, pipelineImage string, step domain.Step, workspace string, logWriter io.Writer) (int, error) {
-	// 1. Pull Image (silently if already exists, but for now we pull)
-	// In a real CI, we'd check if image exists or use a local cache
-	reader, err := r.cli.ImagePull(ctx, pipelineImage, image.PullOptions{})
-	if err != nil {
-		return 0, err
+// RunStep runs a step to completion in a fresh container created from
+// stepImage, which must already have been pulled. The container joins
+// networkName, if set, so it can reach the build's services. If the step has
+// a timeout and exceeds it, the container is killed and ErrStepTimeout returned.
+func (r *DockerRunner) RunStep(ctx context.Context, stepImage string, step domain.Step, workspace, networkName string, logWriter io.Writer) (int, error) {
+	if step.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, time.Duration(step.Timeout), ErrStepTimeout)
+		defer cancel()
 	}
-	io.Copy(io.Discard, reader) // Pull silently for now
-	reader.Close()
 
-	// 2. Prepare commands
+	// 1. Prepare commands
 	// Join all commands with && so they run in sequence and stop on failure
 	fullCmd := ""
 	for i, c := range step.Commands {
@@ -43,26 +51,30 @@ func (r *DockerRunner) RunStep(ctx context.Context, pipelineImage string, step d
 		fullCmd += c
 	}
 
-	// 3. Create Container
+	// 2. Create Container
 	resp, err := r.cli.ContainerCreate(ctx, &container.Config{
-		Image:      pipelineImage,
+		Image:      stepImage,
 		Cmd:        []string{"sh", "-c", fullCmd},
 		Env:        flattenEnv(step.Env),
 		WorkingDir: "/workspace",
 		Tty:        true,
 	}, &container.HostConfig{
-		Binds: []string{fmt.Sprintf("%s:/workspace", workspace)},
+		Binds:       []string{fmt.Sprintf("%s:/workspace", workspace)},
+		NetworkMode: container.NetworkMode(networkName),
 	}, nil, nil, "")
 	if err != nil {
 		return 0, err
 	}
 
-	// 4. Start Container
+	// Whatever happens from here on, the container must not outlive the step
+	defer r.removeContainer(resp.ID)
+
+	// 3. Start Container
 	if err := r.cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
 		return 0, err
 	}
 
-	// 5. Stream Logs
+	// 4. Stream Logs
 	out, err := r.cli.ContainerLogs(ctx, resp.ID, container.LogsOptions{
 		ShowStdout: true,
 		ShowStderr: true,
@@ -75,20 +87,43 @@ func (r *DockerRunner) RunStep(ctx context.Context, pipelineImage string, step d
 		}()
 	}
 
-	// 6. Wait for completion
+	// 5. Wait for completion
 	statusCh, errCh := r.cli.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
 	select {
 	case err := <-errCh:
-		if err != nil {
-			return 0, err
+		if ctx.Err() != nil {
+			r.killContainer(resp.ID)
+			return 0, context.Cause(ctx)
 		}
+		return 0, err
 	case status := <-statusCh:
-		// Cleanup container
-		_ = r.cli.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true})
 		return int(status.StatusCode), nil
 	}
+}
+
+// killContainer stops a step container immediately, without a grace period.
+func (r *DockerRunner) killContainer(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), containerCleanupTimeout)
+	defer cancel()
+
+	if err := r.cli.ContainerKill(ctx, id, "KILL"); err != nil {
+		zap.L().Warn("failed to kill container", zap.String("container", id), zap.Error(err))
+	}
+}
 
-	return 0, nil
+// removeContainer stops and removes a step container. It deliberately ignores
+// the step context, which may already be cancelled.
+func (r *DockerRunner) removeContainer(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), containerCleanupTimeout)
+	defer cancel()
+
+	stopTimeout := 5
+	if err := r.cli.ContainerStop(ctx, id, container.StopOptions{Timeout: &stopTimeout}); err != nil {
+		zap.L().Warn("failed to stop container", zap.String("container", id), zap.Error(err))
+	}
+	if err := r.cli.ContainerRemove(ctx, id, container.RemoveOptions{Force: true}); err != nil {
+		zap.L().Warn("failed to remove container", zap.String("container", id), zap.Error(err))
+	}
 }
 
 func flattenEnv(env map[string]string) []string {
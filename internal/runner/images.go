@@ -0,0 +1,70 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+// ImagePuller pulls each image at most once for the lifetime of a build, even
+// when several steps that share an image start at the same time.
+type ImagePuller struct {
+	runner *DockerRunner
+
+	mu    sync.Mutex
+	pulls map[string]*imagePull
+}
+
+type imagePull struct {
+	done chan struct{}
+	err  error
+}
+
+func (r *DockerRunner) NewImagePuller() *ImagePuller {
+	return &ImagePuller{
+		runner: r,
+		pulls:  make(map[string]*imagePull),
+	}
+}
+
+// Pull makes ref available locally, waiting on an in-flight pull of the same
+// image instead of starting another one.
+func (p *ImagePuller) Pull(ctx context.Context, ref string) error {
+	p.mu.Lock()
+	pull, ok := p.pulls[ref]
+	if !ok {
+		pull = &imagePull{done: make(chan struct{})}
+		p.pulls[ref] = pull
+	}
+	p.mu.Unlock()
+
+	if !ok {
+		pull.err = p.runner.pullImage(ctx, ref)
+		close(pull.done)
+	}
+
+	select {
+	case <-pull.done:
+		return pull.err
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+func (r *DockerRunner) pullImage(ctx context.Context, ref string) error {
+	reader, err := r.cli.ImagePull(ctx, ref, image.PullOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", ref, err)
+	}
+	defer reader.Close()
+
+	// Registry errors such as an unknown tag arrive inside the progress stream
+	if err := jsonmessage.DisplayJSONMessagesStream(reader, io.Discard, 0, false, nil); err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", ref, err)
+	}
+	return nil
+}
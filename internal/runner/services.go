@@ -0,0 +1,201 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"go.uber.org/zap"
+)
+
+const (
+	serviceReadyTimeout = 5 * time.Minute
+	servicePollInterval = time.Second
+)
+
+// errServiceNotReady ends the wait for a service that is still not healthy
+// after serviceReadyTimeout, telling it apart from the build's own deadline.
+var errServiceNotReady = errors.New("service not ready")
+
+// Services are the service containers of one build together with the
+// network that connects them to the build's steps.
+type Services struct {
+	runner     *DockerRunner
+	Network    string
+	containers []string
+}
+
+// StartServices creates a network for the build, starts every service on it
+// under its own name and waits until each one reports healthy. Services
+// without a healthcheck, neither in the pipeline nor in their image, are
+// considered ready once running. On error, everything started is torn down.
+func (r *DockerRunner) StartServices(ctx context.Context, buildID string, services []domain.Service, images *ImagePuller, logWriter io.Writer) (*Services, error) {
+	s := &Services{runner: r}
+	if len(services) == 0 {
+		return s, nil
+	}
+
+	// A requeued build gets the same name; clear out whatever an earlier
+	// attempt on this Docker host left behind.
+	name := "nanoci-" + buildID
+	if err := r.removeStaleNetwork(ctx, name); err != nil {
+		return nil, fmt.Errorf("failed to remove stale build network: %w", err)
+	}
+	if _, err := r.cli.NetworkCreate(ctx, name, network.CreateOptions{Driver: "bridge"}); err != nil {
+		return nil, fmt.Errorf("failed to create build network: %w", err)
+	}
+	s.Network = name
+
+	for _, svc := range services {
+		fmt.Fprintf(logWriter, "==> starting service %s (%s)\n", svc.Name, svc.Image)
+		if err := s.start(ctx, svc, images); err != nil {
+			s.Stop()
+			return nil, fmt.Errorf("service %s: %w", svc.Name, err)
+		}
+	}
+
+	for i, svc := range services {
+		if err := s.waitReady(ctx, s.containers[i]); err != nil {
+			s.Stop()
+			return nil, fmt.Errorf("service %s: %w", svc.Name, err)
+		}
+		fmt.Fprintf(logWriter, "==> service %s is ready\n", svc.Name)
+	}
+	return s, nil
+}
+
+// removeStaleNetwork removes the network called name, if there is one, along
+// with the containers attached to it.
+func (r *DockerRunner) removeStaleNetwork(ctx context.Context, name string) error {
+	info, err := r.cli.NetworkInspect(ctx, name, network.InspectOptions{})
+	if cerrdefs.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	zap.L().Warn("removing network left by an earlier attempt", zap.String("network", name), zap.Int("containers", len(info.Containers)))
+	for id := range info.Containers {
+		r.removeContainer(id)
+	}
+	return r.cli.NetworkRemove(ctx, info.ID)
+}
+
+func (s *Services) start(ctx context.Context, svc domain.Service, images *ImagePuller) error {
+	if err := images.Pull(ctx, svc.Image); err != nil {
+		return err
+	}
+
+	cfg := &container.Config{
+		Image:        svc.Image,
+		Env:          flattenEnv(svc.Env),
+		ExposedPorts: nat.PortSet{},
+	}
+	for _, port := range svc.Ports {
+		cfg.ExposedPorts[nat.Port(fmt.Sprintf("%d/tcp", port))] = struct{}{}
+	}
+	if hc := svc.Healthcheck; hc != nil {
+		cfg.Healthcheck = &container.HealthConfig{
+			Test:        hc.Test,
+			Interval:    time.Duration(hc.Interval),
+			Timeout:     time.Duration(hc.Timeout),
+			StartPeriod: time.Duration(hc.StartPeriod),
+			Retries:     hc.Retries,
+		}
+	}
+
+	resp, err := s.runner.cli.ContainerCreate(ctx, cfg, &container.HostConfig{}, &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			s.Network: {Aliases: []string{svc.Name}},
+		},
+	}, nil, "")
+	if err != nil {
+		return fmt.Errorf("failed to create container: %w", err)
+	}
+	s.containers = append(s.containers, resp.ID)
+
+	if err := s.runner.cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		return fmt.Errorf("failed to start container: %w", err)
+	}
+	return nil
+}
+
+func (s *Services) waitReady(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeoutCause(ctx, serviceReadyTimeout, errServiceNotReady)
+	defer cancel()
+
+	ticker := time.NewTicker(servicePollInterval)
+	defer ticker.Stop()
+
+	for {
+		info, err := s.runner.cli.ContainerInspect(ctx, id)
+		if err != nil {
+			if ctx.Err() != nil {
+				return notReady(ctx)
+			}
+			return fmt.Errorf("failed to inspect container: %w", err)
+		}
+
+		state := info.State
+		switch {
+		case !state.Running:
+			return fmt.Errorf("exited with code %d before becoming ready", state.ExitCode)
+		case state.Health == nil:
+			return nil
+		case state.Health.Status == container.Healthy:
+			return nil
+		case state.Health.Status == container.Unhealthy:
+			return fmt.Errorf("unhealthy: %s", lastProbeOutput(state.Health))
+		}
+
+		select {
+		case <-ctx.Done():
+			return notReady(ctx)
+		case <-ticker.C:
+		}
+	}
+}
+
+// notReady explains why waitReady gave up: the service's own readiness
+// deadline, or whatever ended the build, such as its timeout or a cancel.
+func notReady(ctx context.Context) error {
+	if cause := context.Cause(ctx); !errors.Is(cause, errServiceNotReady) {
+		return cause
+	}
+	return fmt.Errorf("not healthy after %s", serviceReadyTimeout)
+}
+
+// Stop removes the service containers and the build network, regardless of
+// whether the build's context is still alive.
+func (s *Services) Stop() {
+	for _, id := range s.containers {
+		s.runner.removeContainer(id)
+	}
+	s.containers = nil
+
+	if s.Network == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), containerCleanupTimeout)
+	defer cancel()
+	if err := s.runner.cli.NetworkRemove(ctx, s.Network); err != nil {
+		zap.L().Warn("failed to remove network", zap.String("network", s.Network), zap.Error(err))
+	}
+	s.Network = ""
+}
+
+func lastProbeOutput(h *container.Health) string {
+	if len(h.Log) == 0 {
+		return "no healthcheck output"
+	}
+	return strings.TrimSpace(h.Log[len(h.Log)-1].Output)
+}
@@ -0,0 +1,120 @@
+package scm
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// appAuth obtains installation access tokens for a GitHub App, caching them
+// per repository until shortly before they expire.
+type appAuth struct {
+	client *http.Client
+	apiURL string
+	appID  int64
+	key    *rsa.PrivateKey
+
+	mu     sync.Mutex
+	tokens map[string]appToken
+}
+
+type appToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// tokenRefreshMargin is how long before expiry a cached token is replaced.
+const tokenRefreshMargin = 5 * time.Minute
+
+func newAppAuth(client *http.Client, apiURL string, appID int64, keyPEM string) (*appAuth, error) {
+	// Keys passed through the environment often have their newlines escaped
+	keyPEM = strings.ReplaceAll(keyPEM, `\n`, "\n")
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+
+	var key *rsa.PrivateKey
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		key = k
+	} else {
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		var ok bool
+		if key, ok = parsed.(*rsa.PrivateKey); !ok {
+			return nil, errors.New("private key is not an RSA key")
+		}
+	}
+
+	return &appAuth{client: client, apiURL: apiURL, appID: appID, key: key, tokens: make(map[string]appToken)}, nil
+}
+
+// installationToken returns a token for the app's installation on owner/repo.
+func (a *appAuth) installationToken(ctx context.Context, owner, repo string) (string, error) {
+	name := owner + "/" + repo
+	a.mu.Lock()
+	cached, ok := a.tokens[name]
+	a.mu.Unlock()
+	if ok && time.Until(cached.ExpiresAt) > tokenRefreshMargin {
+		return cached.Token, nil
+	}
+
+	jwt, err := a.jwt(time.Now())
+	if err != nil {
+		return "", err
+	}
+	var installation struct {
+		ID int64 `json:"id"`
+	}
+	url := fmt.Sprintf("%s/repos/%s/%s/installation", a.apiURL, owner, repo)
+	if err := doJSON(ctx, a.client, http.MethodGet, url, githubHeaders("Bearer "+jwt), nil, &installation); err != nil {
+		return "", err
+	}
+
+	var token appToken
+	url = fmt.Sprintf("%s/app/installations/%d/access_tokens", a.apiURL, installation.ID)
+	if err := doJSON(ctx, a.client, http.MethodPost, url, githubHeaders("Bearer "+jwt), nil, &token); err != nil {
+		return "", err
+	}
+
+	a.mu.Lock()
+	a.tokens[name] = token
+	a.mu.Unlock()
+	return token.Token, nil
+}
+
+// jwt signs the short-lived token that authenticates as the app itself. It
+// is backdated a minute to allow for clock drift.
+func (a *appAuth) jwt(now time.Time) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]int64{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": a.appID,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
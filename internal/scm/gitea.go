@@ -0,0 +1,97 @@
+package scm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/princetheprogrammerbtw/nanoci/internal/config"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"github.com/princetheprogrammerbtw/nanoci/internal/status"
+)
+
+// Gitea builds pushes and pull requests of repositories on the Gitea
+// instance at GITEA_URL, whose webhooks mirror GitHub's. Commit statuses are
+// posted with the project's token credential; projects without one, or all
+// projects while GITEA_URL is unset, are not reported for.
+type Gitea struct {
+	client        *http.Client
+	baseURL       string
+	publicURL     string
+	encryptionKey []byte
+}
+
+func NewGitea(cfg *config.Config) *Gitea {
+	return &Gitea{
+		client:        &http.Client{Timeout: httpTimeout},
+		baseURL:       strings.TrimRight(cfg.GiteaURL, "/"),
+		publicURL:     strings.TrimRight(cfg.PublicURL, "/"),
+		encryptionKey: []byte(cfg.EncryptionKey),
+	}
+}
+
+func (g *Gitea) Name() domain.SCMProvider {
+	return domain.SCMProviderGitea
+}
+
+func (g *Gitea) RepoID(payload []byte) (string, error) {
+	return repositoryID(payload)
+}
+
+// Verify checks X-Gitea-Signature, the hex HMAC of the payload keyed with
+// the webhook secret.
+func (g *Gitea) Verify(header http.Header, payload []byte, secret string) bool {
+	signature := header.Get("X-Gitea-Signature")
+	return signature != "" && validHMAC(secret, signature, payload)
+}
+
+// giteaPullRequestActions are the pull_request actions that put new code up
+// for review. Gitea spells GitHub's synchronize in the past tense.
+var giteaPullRequestActions = map[string]bool{"opened": true, "synchronized": true, "reopened": true}
+
+func (g *Gitea) Event(header http.Header) string {
+	return header.Get("X-Gitea-Event")
+}
+
+func (g *Gitea) DeliveryID(header http.Header) string {
+	return header.Get("X-Gitea-Delivery")
+}
+
+func (g *Gitea) Build(event string, payload []byte) (*domain.Build, error) {
+	switch event {
+	case "push":
+		return pushBuild(payload)
+	case "pull_request":
+		return pullRequestBuild(payload, giteaPullRequestActions)
+	}
+	return nil, nil
+}
+
+func (g *Gitea) Report(ctx context.Context, project *domain.Project, build *domain.Build) error {
+	s, ok := states[build.Status]
+	if !ok || g.baseURL == "" {
+		return nil
+	}
+	owner, repo, ok := repoPath(project.RepoURL)
+	if !ok {
+		return nil
+	}
+	token, err := projectToken(project, g.encryptionKey)
+	if err != nil || token == "" {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"state":       s.state,
+		"target_url":  targetURL(g.publicURL, build),
+		"description": s.description,
+		"context":     status.Context(build),
+	})
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/api/v1/repos/%s/%s/statuses/%s", g.baseURL, owner, repo, build.CommitHash)
+	return doJSON(ctx, g.client, http.MethodPost, endpoint, map[string]string{"Authorization": "token " + token}, body, nil)
+}
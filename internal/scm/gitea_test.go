@@ -0,0 +1,58 @@
+package scm
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/princetheprogrammerbtw/nanoci/internal/config"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+)
+
+func TestGiteaBuild(t *testing.T) {
+	g := NewGitea(&config.Config{})
+	pr := []byte(`{"action": "synchronized", "number": 9, "repository": {"id": 4},
+		"pull_request": {"title": "Add feature",
+			"head": {"ref": "feature", "sha": "def456", "repo": {"id": 4}},
+			"base": {"ref": "main", "repo": {"id": 4}}}}`)
+	if id, err := g.RepoID(pr); err != nil || id != "4" {
+		t.Fatalf("Expected repo ID 4, got %q (%v)", id, err)
+	}
+	build, err := g.Build("pull_request", pr)
+	if err != nil || build == nil {
+		t.Fatalf("Expected a build, got %v (%v)", build, err)
+	}
+	if *build.PRNumber != 9 || build.CommitHash != "def456" || build.Branch != "main" || build.Fork {
+		t.Errorf("Unexpected pull request build: %+v", build)
+	}
+
+	deleted := []byte(`{"ref": "refs/heads/old", "after": "` + zeroSHA + `", "repository": {"id": 4}}`)
+	if build, _ := g.Build("push", deleted); build != nil {
+		t.Errorf("Expected no build for a deleted branch, got %+v", build)
+	}
+}
+
+func TestGiteaVerify(t *testing.T) {
+	g := NewGitea(&config.Config{})
+	payload := []byte(`{"ref": "refs/heads/main"}`)
+	header := http.Header{}
+	header.Set("X-Gitea-Signature", "0000")
+	if g.Verify(header, payload, "s3cret") {
+		t.Error("Expected a wrong signature to be rejected")
+	}
+	// echo -n '{"ref": "refs/heads/main"}' | openssl dgst -sha256 -hmac s3cret
+	header.Set("X-Gitea-Signature", "0b73f95767616f2bc5f64e406f60acc56a2b962c202d5c7b12807ff54976d5d0")
+	if !g.Verify(header, payload, "s3cret") {
+		t.Error("Expected the right signature to be accepted")
+	}
+}
+
+func TestGiteaReportWithoutURL(t *testing.T) {
+	g := NewGitea(&config.Config{})
+	project := &domain.Project{ID: uuid.New(), RepoURL: "https://gitea.example.com/org/app.git"}
+	build := &domain.Build{ID: uuid.New(), CommitHash: "abc123", Status: domain.BuildStatusSuccess}
+	if err := g.Report(context.Background(), project, build); err != nil {
+		t.Errorf("Expected reporting to be skipped without GITEA_URL, got %v", err)
+	}
+}
@@ -0,0 +1,235 @@
+package scm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/princetheprogrammerbtw/nanoci/internal/config"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"github.com/princetheprogrammerbtw/nanoci/internal/status"
+)
+
+// states maps build statuses to GitHub commit status states and descriptions.
+// Gitea accepts the same states.
+var states = map[domain.BuildStatus]struct{ state, description string }{
+	domain.BuildStatusPending:   {"pending", "Build queued"},
+	domain.BuildStatusRunning:   {"pending", "Build running"},
+	domain.BuildStatusSuccess:   {"success", "Build passed"},
+	domain.BuildStatusFailed:    {"failure", "Build failed"},
+	domain.BuildStatusTimedOut:  {"failure", "Build timed out"},
+	domain.BuildStatusCancelled: {"error", "Build cancelled"},
+}
+
+// GitHub builds pushes and pull requests of GitHub repositories and posts
+// commit statuses through the GitHub REST API. It authenticates with the
+// project's token credential if it has one, and otherwise as a GitHub App
+// installation when an app is configured. Projects with neither are not
+// reported for.
+type GitHub struct {
+	client        *http.Client
+	apiURL        string
+	publicURL     string
+	encryptionKey []byte
+	app           *appAuth
+}
+
+func NewGitHub(cfg *config.Config) (*GitHub, error) {
+	g := &GitHub{
+		client:        &http.Client{Timeout: httpTimeout},
+		apiURL:        strings.TrimRight(cfg.GithubAPIURL, "/"),
+		publicURL:     strings.TrimRight(cfg.PublicURL, "/"),
+		encryptionKey: []byte(cfg.EncryptionKey),
+	}
+	if cfg.GithubAppID != 0 {
+		app, err := newAppAuth(g.client, g.apiURL, cfg.GithubAppID, cfg.GithubAppKey)
+		if err != nil {
+			return nil, fmt.Errorf("github app: %w", err)
+		}
+		g.app = app
+	}
+	return g, nil
+}
+
+func (g *GitHub) Name() domain.SCMProvider {
+	return domain.SCMProviderGitHub
+}
+
+func (g *GitHub) RepoID(payload []byte) (string, error) {
+	return repositoryID(payload)
+}
+
+// Verify checks X-Hub-Signature-256, the HMAC of the payload keyed with the
+// webhook secret.
+func (g *GitHub) Verify(header http.Header, payload []byte, secret string) bool {
+	signature := header.Get("X-Hub-Signature-256")
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	return validHMAC(secret, strings.TrimPrefix(signature, "sha256="), payload)
+}
+
+// githubPullRequestActions are the pull_request actions that put new code up
+// for review.
+var githubPullRequestActions = map[string]bool{"opened": true, "synchronize": true, "reopened": true}
+
+func (g *GitHub) Event(header http.Header) string {
+	return header.Get("X-GitHub-Event")
+}
+
+func (g *GitHub) DeliveryID(header http.Header) string {
+	return header.Get("X-GitHub-Delivery")
+}
+
+func (g *GitHub) Build(event string, payload []byte) (*domain.Build, error) {
+	switch event {
+	case "push":
+		return pushBuild(payload)
+	case "pull_request":
+		return pullRequestBuild(payload, githubPullRequestActions)
+	}
+	// ping and events we don't build for
+	return nil, nil
+}
+
+func (g *GitHub) Report(ctx context.Context, project *domain.Project, build *domain.Build) error {
+	s, ok := states[build.Status]
+	if !ok {
+		return nil
+	}
+	owner, repo, ok := repoPath(project.RepoURL)
+	if !ok {
+		return nil
+	}
+	token, err := g.token(ctx, project, owner, repo)
+	if err != nil || token == "" {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"state":       s.state,
+		"target_url":  targetURL(g.publicURL, build),
+		"description": s.description,
+		"context":     status.Context(build),
+	})
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/statuses/%s", g.apiURL, owner, repo, build.CommitHash)
+	return doJSON(ctx, g.client, http.MethodPost, endpoint, githubHeaders("token "+token), body, nil)
+}
+
+// token returns the credential to report with, or "" if there is none.
+func (g *GitHub) token(ctx context.Context, project *domain.Project, owner, repo string) (string, error) {
+	if project.CredentialType == domain.CredentialTypeToken {
+		return projectToken(project, g.encryptionKey)
+	}
+	if g.app != nil {
+		return g.app.installationToken(ctx, owner, repo)
+	}
+	return "", nil
+}
+
+// githubHeaders are the headers of a GitHub API request authorized with auth.
+func githubHeaders(auth string) map[string]string {
+	return map[string]string{"Accept": "application/vnd.github+json", "Authorization": auth}
+}
+
+// The webhook payloads below are shared with Gitea, which mirrors GitHub's.
+
+type githubRepo struct {
+	ID       int64  `json:"id"`
+	FullName string `json:"full_name"`
+}
+
+type githubPushPayload struct {
+	Ref        string       `json:"ref"`
+	After      string       `json:"after"`
+	Deleted    bool         `json:"deleted"`
+	HeadCommit *pushCommit  `json:"head_commit"`
+	Commits    []pushCommit `json:"commits"`
+	// TotalCommits is only sent by Gitea, whose Commits may be cut short
+	TotalCommits int `json:"total_commits"`
+}
+
+type githubPullRequestPayload struct {
+	Action      string `json:"action"`
+	Number      int    `json:"number"`
+	PullRequest struct {
+		Title string `json:"title"`
+		Head  struct {
+			Ref  string      `json:"ref"`
+			SHA  string      `json:"sha"`
+			Repo *githubRepo `json:"repo"`
+		} `json:"head"`
+		Base struct {
+			Ref  string     `json:"ref"`
+			Repo githubRepo `json:"repo"`
+		} `json:"base"`
+	} `json:"pull_request"`
+}
+
+// repositoryID returns the ID of the repository in a GitHub-style payload.
+func repositoryID(payload []byte) (string, error) {
+	var envelope struct {
+		Repository githubRepo `json:"repository"`
+	}
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(envelope.Repository.ID, 10), nil
+}
+
+// pushBuild returns the build for a push of a branch or tag, or nil if the
+// push is not one we build, such as a deletion.
+func pushBuild(payload []byte) (*domain.Build, error) {
+	var event githubPushPayload
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	if event.Deleted || event.After == zeroSHA {
+		return nil, nil
+	}
+
+	build := refBuild(event.Ref, event.Commits, event.TotalCommits)
+	if build == nil {
+		return nil, nil
+	}
+	// head_commit is the tagged commit, even for annotated tags
+	build.CommitHash = event.After
+	if event.HeadCommit != nil {
+		build.CommitHash = event.HeadCommit.ID
+		build.CommitMessage = event.HeadCommit.Message
+	}
+	return build, nil
+}
+
+// pullRequestBuild returns the build for a pull request's head commit, or
+// nil for actions that bring no new code, such as labelling or closing.
+func pullRequestBuild(payload []byte, actions map[string]bool) (*domain.Build, error) {
+	var event githubPullRequestPayload
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	if !actions[event.Action] {
+		return nil, nil
+	}
+
+	pr := event.PullRequest
+	number := event.Number
+	// The head repository is null once a fork has been deleted
+	fork := pr.Head.Repo == nil || pr.Head.Repo.ID != pr.Base.Repo.ID
+	return &domain.Build{
+		CommitHash:    pr.Head.SHA,
+		CommitMessage: pr.Title,
+		Branch:        pr.Base.Ref,
+		Event:         domain.BuildEventPullRequest,
+		PRNumber:      &number,
+		SourceBranch:  pr.Head.Ref,
+		CheckoutRef:   fmt.Sprintf("refs/pull/%d/head", number),
+		Fork:          fork,
+	}, nil
+}
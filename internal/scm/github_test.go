@@ -0,0 +1,232 @@
+package scm
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/princetheprogrammerbtw/nanoci/internal/config"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	nanocrypto "github.com/princetheprogrammerbtw/nanoci/pkg/crypto"
+)
+
+const testKey = "0123456789abcdef0123456789abcdef"
+
+// fakeGitHub records the commit statuses posted to it.
+type fakeGitHub struct {
+	mu       sync.Mutex
+	statuses []map[string]string
+	auth     []string
+	appKey   *rsa.PublicKey
+}
+
+func (g *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.auth = append(g.auth, r.Header.Get("Authorization"))
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/repos/octo/app/installation":
+		if !g.validJWT(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"id": 42}`))
+	case r.Method == http.MethodPost && r.URL.Path == "/app/installations/42/access_tokens":
+		if !g.validJWT(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		expires := time.Now().Add(time.Hour).Format(time.RFC3339)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"token": "installation-token", "expires_at": "` + expires + `"}`))
+	case r.Method == http.MethodPost && r.URL.Path == "/repos/octo/app/statuses/abc123":
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		g.statuses = append(g.statuses, body)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (g *fakeGitHub) validJWT(r *http.Request) bool {
+	parts := strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), ".")
+	if len(parts) != 3 {
+		return false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	return rsa.VerifyPKCS1v15(g.appKey, crypto.SHA256, digest[:], sig) == nil
+}
+
+func TestGitHubReportWithProjectToken(t *testing.T) {
+	gh := &fakeGitHub{}
+	srv := httptest.NewServer(gh)
+	defer srv.Close()
+
+	token, err := nanocrypto.Encrypt("project-token", []byte(testKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	project := &domain.Project{
+		ID:                  uuid.New(),
+		RepoURL:             "https://github.com/octo/app.git",
+		CredentialType:      domain.CredentialTypeToken,
+		EncryptedCredential: token,
+	}
+	r, err := NewGitHub(&config.Config{
+		GithubAPIURL:  srv.URL,
+		PublicURL:     "https://ci.example.com",
+		EncryptionKey: testKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	build := &domain.Build{ID: uuid.New(), ProjectID: project.ID, CommitHash: "abc123"}
+	for _, s := range []domain.BuildStatus{domain.BuildStatusPending, domain.BuildStatusRunning, domain.BuildStatusFailed} {
+		build.Status = s
+		if err := r.Report(context.Background(), project, build); err != nil {
+			t.Fatalf("Report(%s) failed: %v", s, err)
+		}
+	}
+
+	var states []string
+	for _, s := range gh.statuses {
+		states = append(states, s["state"])
+	}
+	if got := strings.Join(states, ","); got != "pending,pending,failure" {
+		t.Errorf("Expected pending,pending,failure, got %s", got)
+	}
+	last := gh.statuses[2]
+	if last["context"] != "nanoci" || last["target_url"] != "https://ci.example.com/builds/"+build.ID.String() {
+		t.Errorf("Unexpected status: %v", last)
+	}
+	if gh.auth[0] != "token project-token" {
+		t.Errorf("Expected project token, got %q", gh.auth[0])
+	}
+}
+
+func TestGitHubReportWithApp(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	gh := &fakeGitHub{appKey: &key.PublicKey}
+	srv := httptest.NewServer(gh)
+	defer srv.Close()
+
+	project := &domain.Project{ID: uuid.New(), RepoURL: "git@github.com:octo/app.git"}
+	r, err := NewGitHub(&config.Config{
+		GithubAPIURL: srv.URL,
+		GithubAppID:  7,
+		GithubAppKey: strings.ReplaceAll(string(keyPEM), "\n", `\n`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	build := &domain.Build{
+		ID:         uuid.New(),
+		ProjectID:  project.ID,
+		CommitHash: "abc123",
+		Status:     domain.BuildStatusSuccess,
+		Matrix:     map[string]string{"OS": "linux", "GO": "1.22"},
+	}
+	for i := 0; i < 2; i++ {
+		if err := r.Report(context.Background(), project, build); err != nil {
+			t.Fatalf("Report failed: %v", err)
+		}
+	}
+
+	if len(gh.statuses) != 2 || gh.statuses[0]["state"] != "success" || gh.statuses[0]["context"] != "nanoci/GO=1.22,OS=linux" {
+		t.Fatalf("Unexpected statuses: %v", gh.statuses)
+	}
+	// The installation token is fetched once and reused
+	if len(gh.auth) != 4 || gh.auth[2] != "token installation-token" || gh.auth[3] != "token installation-token" {
+		t.Errorf("Unexpected requests: %v", gh.auth)
+	}
+}
+
+func TestGitHubReportSkipsProjectsWithoutCredentials(t *testing.T) {
+	gh := &fakeGitHub{}
+	srv := httptest.NewServer(gh)
+	defer srv.Close()
+
+	project := &domain.Project{ID: uuid.New(), RepoURL: "https://github.com/octo/app"}
+	r, err := NewGitHub(&config.Config{GithubAPIURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	build := &domain.Build{ID: uuid.New(), ProjectID: project.ID, CommitHash: "abc123", Status: domain.BuildStatusSuccess}
+	if err := r.Report(context.Background(), project, build); err != nil {
+		t.Fatal(err)
+	}
+	if len(gh.auth) != 0 {
+		t.Errorf("Expected no requests, got %d", len(gh.auth))
+	}
+}
+
+func TestRepoPath(t *testing.T) {
+	tests := map[string]string{
+		"https://github.com/octo/app.git":     "octo/app",
+		"https://github.com/octo/app":         "octo/app",
+		"git@github.com:octo/app.git":         "octo/app",
+		"ssh://git@github.com/octo/app.git":   "octo/app",
+		"https://github.example.com/octo/app": "octo/app",
+		"https://github.com/octo":             "",
+	}
+	for url, want := range tests {
+		owner, repo, ok := repoPath(url)
+		got := ""
+		if ok {
+			got = owner + "/" + repo
+		}
+		if got != want {
+			t.Errorf("repoPath(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
+
+func TestGitHubBuild(t *testing.T) {
+	g, err := NewGitHub(&config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := []byte(`{"ref": "refs/tags/v1.0.0", "after": "abc123", "head_commit": {"id": "abc123", "message": "Release"}}`)
+	build, err := g.Build("push", tag)
+	if err != nil || build == nil {
+		t.Fatalf("Expected a build, got %v (%v)", build, err)
+	}
+	if build.Event != domain.BuildEventTag || build.Tag != "v1.0.0" || build.Branch != "" || build.CommitMessage != "Release" {
+		t.Errorf("Unexpected tag build: %+v", build)
+	}
+
+	deleted := []byte(`{"ref": "refs/heads/old", "after": "` + zeroSHA + `", "deleted": true, "head_commit": null}`)
+	if build, _ := g.Build("push", deleted); build != nil {
+		t.Errorf("Expected no build for a deleted branch, got %+v", build)
+	}
+
+	if build, err := g.Build("ping", []byte(`{}`)); build != nil || err != nil {
+		t.Errorf("Expected pings to be ignored, got %v (%v)", build, err)
+	}
+}
@@ -0,0 +1,190 @@
+package scm
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/princetheprogrammerbtw/nanoci/internal/config"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"github.com/princetheprogrammerbtw/nanoci/internal/status"
+)
+
+// gitlabStates maps build statuses to GitLab commit status states and
+// descriptions.
+var gitlabStates = map[domain.BuildStatus]struct{ state, description string }{
+	domain.BuildStatusPending:   {"pending", "Build queued"},
+	domain.BuildStatusRunning:   {"running", "Build running"},
+	domain.BuildStatusSuccess:   {"success", "Build passed"},
+	domain.BuildStatusFailed:    {"failed", "Build failed"},
+	domain.BuildStatusTimedOut:  {"failed", "Build timed out"},
+	domain.BuildStatusCancelled: {"canceled", "Build cancelled"},
+}
+
+// GitLab builds pushes and merge requests of GitLab projects, on gitlab.com
+// or a self-hosted instance at GITLAB_URL. Commit statuses are posted with
+// the project's token credential; projects without one are not reported for.
+type GitLab struct {
+	client        *http.Client
+	baseURL       string
+	publicURL     string
+	encryptionKey []byte
+}
+
+func NewGitLab(cfg *config.Config) *GitLab {
+	return &GitLab{
+		client:        &http.Client{Timeout: httpTimeout},
+		baseURL:       strings.TrimRight(cfg.GitlabURL, "/"),
+		publicURL:     strings.TrimRight(cfg.PublicURL, "/"),
+		encryptionKey: []byte(cfg.EncryptionKey),
+	}
+}
+
+func (g *GitLab) Name() domain.SCMProvider {
+	return domain.SCMProviderGitLab
+}
+
+func (g *GitLab) RepoID(payload []byte) (string, error) {
+	var envelope struct {
+		Project struct {
+			ID int64 `json:"id"`
+		} `json:"project"`
+	}
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(envelope.Project.ID, 10), nil
+}
+
+// Verify checks X-Gitlab-Token. GitLab does not sign payloads; it sends the
+// webhook secret itself.
+func (g *GitLab) Verify(header http.Header, payload []byte, secret string) bool {
+	token := header.Get("X-Gitlab-Token")
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+}
+
+type gitlabPushPayload struct {
+	Ref         string       `json:"ref"`
+	After       string       `json:"after"`
+	CheckoutSHA string       `json:"checkout_sha"`
+	Commits     []pushCommit `json:"commits"`
+	// TotalCommits counts every commit pushed; Commits lists at most 20
+	TotalCommits int `json:"total_commits_count"`
+}
+
+type gitlabMergeRequestPayload struct {
+	ObjectAttributes struct {
+		IID             int    `json:"iid"`
+		Title           string `json:"title"`
+		Action          string `json:"action"`
+		OldRev          string `json:"oldrev"`
+		SourceBranch    string `json:"source_branch"`
+		TargetBranch    string `json:"target_branch"`
+		SourceProjectID int64  `json:"source_project_id"`
+		TargetProjectID int64  `json:"target_project_id"`
+		LastCommit      struct {
+			ID string `json:"id"`
+		} `json:"last_commit"`
+	} `json:"object_attributes"`
+}
+
+func (g *GitLab) Event(header http.Header) string {
+	return header.Get("X-Gitlab-Event")
+}
+
+// DeliveryID returns X-Gitlab-Event-UUID, which GitLab keeps when it retries.
+func (g *GitLab) DeliveryID(header http.Header) string {
+	return header.Get("X-Gitlab-Event-UUID")
+}
+
+func (g *GitLab) Build(event string, payload []byte) (*domain.Build, error) {
+	switch event {
+	case "Push Hook", "Tag Push Hook":
+		return g.pushBuild(payload)
+	case "Merge Request Hook":
+		return g.mergeRequestBuild(payload)
+	}
+	return nil, nil
+}
+
+// pushBuild returns the build for a push of a branch or tag, or nil if the
+// push is a deletion.
+func (g *GitLab) pushBuild(payload []byte) (*domain.Build, error) {
+	var event gitlabPushPayload
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	if event.After == zeroSHA || event.CheckoutSHA == "" {
+		return nil, nil
+	}
+
+	build := refBuild(event.Ref, event.Commits, event.TotalCommits)
+	if build == nil {
+		return nil, nil
+	}
+	// checkout_sha is the tagged commit, even for annotated tags
+	build.CommitHash = event.CheckoutSHA
+	for _, c := range event.Commits {
+		if c.ID == event.CheckoutSHA {
+			build.CommitMessage = c.Message
+		}
+	}
+	return build, nil
+}
+
+// mergeRequestBuild returns the build for a merge request's head commit, or
+// nil for actions that bring no new code. Updates only do when they carry
+// oldrev, meaning commits were pushed.
+func (g *GitLab) mergeRequestBuild(payload []byte) (*domain.Build, error) {
+	var event gitlabMergeRequestPayload
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	mr := event.ObjectAttributes
+	switch {
+	case mr.Action == "open" || mr.Action == "reopen":
+	case mr.Action == "update" && mr.OldRev != "":
+	default:
+		return nil, nil
+	}
+
+	number := mr.IID
+	return &domain.Build{
+		CommitHash:    mr.LastCommit.ID,
+		CommitMessage: mr.Title,
+		Branch:        mr.TargetBranch,
+		Event:         domain.BuildEventPullRequest,
+		PRNumber:      &number,
+		SourceBranch:  mr.SourceBranch,
+		CheckoutRef:   fmt.Sprintf("refs/merge-requests/%d/head", number),
+		Fork:          mr.SourceProjectID != mr.TargetProjectID,
+	}, nil
+}
+
+func (g *GitLab) Report(ctx context.Context, project *domain.Project, build *domain.Build) error {
+	s, ok := gitlabStates[build.Status]
+	if !ok || project.RepoID == "" {
+		return nil
+	}
+	token, err := projectToken(project, g.encryptionKey)
+	if err != nil || token == "" {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"state":       s.state,
+		"target_url":  targetURL(g.publicURL, build),
+		"description": s.description,
+		"name":        status.Context(build),
+	})
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/api/v4/projects/%s/statuses/%s", g.baseURL, url.PathEscape(project.RepoID), build.CommitHash)
+	return doJSON(ctx, g.client, http.MethodPost, endpoint, map[string]string{"PRIVATE-TOKEN": token}, body, nil)
+}
@@ -0,0 +1,119 @@
+package scm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/princetheprogrammerbtw/nanoci/internal/config"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	nanocrypto "github.com/princetheprogrammerbtw/nanoci/pkg/crypto"
+)
+
+func TestGitLabBuild(t *testing.T) {
+	g := NewGitLab(&config.Config{GitlabURL: "https://gitlab.com"})
+
+	push := []byte(`{"ref": "refs/heads/main", "after": "abc123", "checkout_sha": "abc123", "project": {"id": 15},
+		"commits": [{"id": "abc123", "message": "Fix it", "added": ["a.go"], "modified": ["b.go"], "removed": []}]}`)
+	if id, err := g.RepoID(push); err != nil || id != "15" {
+		t.Fatalf("Expected repo ID 15, got %q (%v)", id, err)
+	}
+	build, err := g.Build("Push Hook", push)
+	if err != nil || build == nil {
+		t.Fatalf("Expected a build, got %v (%v)", build, err)
+	}
+	if build.Branch != "main" || build.CommitHash != "abc123" || build.CommitMessage != "Fix it" || len(build.ChangedFiles) != 2 {
+		t.Errorf("Unexpected push build: %+v", build)
+	}
+
+	truncated := []byte(`{"ref": "refs/heads/main", "after": "abc123", "checkout_sha": "abc123", "total_commits_count": 25,
+		"commits": [{"id": "abc123", "message": "Fix it", "added": ["a.go"], "modified": [], "removed": []}]}`)
+	if build, _ := g.Build("Push Hook", truncated); build == nil || build.ChangedFiles != nil {
+		t.Errorf("Expected unknown changed files for a truncated push, got %+v", build)
+	}
+
+	tag := []byte(`{"ref": "refs/tags/v1.0.0", "after": "tagobject", "checkout_sha": "abc123", "commits": []}`)
+	if build, _ := g.Build("Tag Push Hook", tag); build == nil || build.Tag != "v1.0.0" || build.CommitHash != "abc123" {
+		t.Errorf("Unexpected tag build: %+v", build)
+	}
+
+	deleted := []byte(`{"ref": "refs/heads/old", "after": "` + zeroSHA + `", "checkout_sha": null}`)
+	if build, _ := g.Build("Push Hook", deleted); build != nil {
+		t.Errorf("Expected no build for a deleted branch, got %+v", build)
+	}
+
+	mr := func(action, oldrev string) []byte {
+		return []byte(`{"project": {"id": 15}, "object_attributes": {"iid": 3, "title": "Add feature", "action": "` + action + `",
+			"oldrev": "` + oldrev + `", "source_branch": "feature", "target_branch": "main",
+			"source_project_id": 16, "target_project_id": 15, "last_commit": {"id": "def456"}}}`)
+	}
+	build, err = g.Build("Merge Request Hook", mr("open", ""))
+	if err != nil || build == nil {
+		t.Fatalf("Expected a build, got %v (%v)", build, err)
+	}
+	if build.Event != domain.BuildEventPullRequest || *build.PRNumber != 3 || build.Branch != "main" || build.SourceBranch != "feature" || !build.Fork {
+		t.Errorf("Unexpected merge request build: %+v", build)
+	}
+	if build.Ref() != "refs/merge-requests/3/head" {
+		t.Errorf("Expected the merge request ref, got %s", build.Ref())
+	}
+	if build, _ := g.Build("Merge Request Hook", mr("update", "")); build != nil {
+		t.Error("Expected no build for an update without new commits")
+	}
+	if build, _ := g.Build("Merge Request Hook", mr("update", "abc123")); build == nil {
+		t.Error("Expected a build for an update with new commits")
+	}
+}
+
+func TestGitLabVerify(t *testing.T) {
+	g := NewGitLab(&config.Config{})
+	header := http.Header{}
+	if g.Verify(header, nil, "s3cret") {
+		t.Error("Expected a delivery without a token to be rejected")
+	}
+	header.Set("X-Gitlab-Token", "wrong")
+	if g.Verify(header, nil, "s3cret") {
+		t.Error("Expected a wrong token to be rejected")
+	}
+	header.Set("X-Gitlab-Token", "s3cret")
+	if !g.Verify(header, nil, "s3cret") {
+		t.Error("Expected the right token to be accepted")
+	}
+}
+
+func TestGitLabReport(t *testing.T) {
+	var got map[string]string
+	var path, token string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, token = r.URL.Path, r.Header.Get("PRIVATE-TOKEN")
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	credential, err := nanocrypto.Encrypt("project-token", []byte(testKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	project := &domain.Project{
+		ID:                  uuid.New(),
+		Provider:            domain.SCMProviderGitLab,
+		RepoID:              "15",
+		CredentialType:      domain.CredentialTypeToken,
+		EncryptedCredential: credential,
+	}
+	g := NewGitLab(&config.Config{GitlabURL: srv.URL, EncryptionKey: testKey})
+	build := &domain.Build{ID: uuid.New(), ProjectID: project.ID, CommitHash: "abc123", Status: domain.BuildStatusCancelled}
+	if err := g.Report(context.Background(), project, build); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/api/v4/projects/15/statuses/abc123" || token != "project-token" {
+		t.Errorf("Unexpected request to %s with token %q", path, token)
+	}
+	if got["state"] != "canceled" || got["name"] != "nanoci" {
+		t.Errorf("Unexpected status: %v", got)
+	}
+}
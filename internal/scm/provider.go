@@ -0,0 +1,213 @@
+package scm
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/princetheprogrammerbtw/nanoci/internal/config"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"github.com/princetheprogrammerbtw/nanoci/pkg/crypto"
+)
+
+const httpTimeout = 10 * time.Second
+
+// zeroSHA is the commit a ref points at before it is created or after it
+// is deleted.
+const zeroSHA = "0000000000000000000000000000000000000000"
+
+// Provider is a source code host that repositories are built from. It turns
+// the host's webhooks into builds and reports their statuses back to it.
+type Provider interface {
+	// Name is the provider's segment in /webhooks/{provider} and its value
+	// of Project.Provider.
+	Name() domain.SCMProvider
+	// RepoID returns the host's ID for the repository a webhook is about.
+	RepoID(payload []byte) (string, error)
+	// Verify reports whether a webhook was sent by the host for a project
+	// with the given webhook secret.
+	Verify(header http.Header, payload []byte, secret string) bool
+	// Event returns the type of event a webhook is for, such as push.
+	Event(header http.Header) string
+	// DeliveryID returns the host's ID for a webhook delivery, which stays
+	// the same when the host retries it, or "" if the host sends none.
+	DeliveryID(header http.Header) string
+	// Build returns the build a webhook for event triggers, or nil if it
+	// triggers none. The caller sets ProjectID and Status.
+	Build(event string, payload []byte) (*domain.Build, error)
+	// Report publishes the status of build to its commit in project's
+	// repository. Projects it cannot report for are skipped.
+	Report(ctx context.Context, project *domain.Project, build *domain.Build) error
+}
+
+// Registry holds the supported providers. It is the status.Reporter for all
+// builds, reporting each through the provider of the build's project.
+type Registry struct {
+	projectRepo domain.ProjectRepository
+	providers   map[domain.SCMProvider]Provider
+}
+
+func NewRegistry(pr domain.ProjectRepository, cfg *config.Config) (*Registry, error) {
+	github, err := NewGitHub(cfg)
+	if err != nil {
+		return nil, err
+	}
+	r := &Registry{projectRepo: pr, providers: make(map[domain.SCMProvider]Provider)}
+	for _, p := range []Provider{github, NewGitLab(cfg), NewGitea(cfg)} {
+		r.providers[p.Name()] = p
+	}
+	return r, nil
+}
+
+// Get returns the provider called name, or nil if there is none.
+func (r *Registry) Get(name string) Provider {
+	return r.providers[domain.SCMProvider(name)]
+}
+
+func (r *Registry) Report(ctx context.Context, build *domain.Build) error {
+	if build.CommitHash == "" {
+		return nil
+	}
+	project, err := r.projectRepo.GetByID(ctx, build.ProjectID)
+	if err != nil || project == nil {
+		return err
+	}
+	p, ok := r.providers[project.Provider]
+	if !ok {
+		return nil
+	}
+	return p.Report(ctx, project, build)
+}
+
+// projectToken returns the project's access token, or "" if its credential
+// is not a token.
+func projectToken(project *domain.Project, key []byte) (string, error) {
+	if project.CredentialType != domain.CredentialTypeToken {
+		return "", nil
+	}
+	return crypto.Decrypt(project.EncryptedCredential, key)
+}
+
+// targetURL links a commit status to the build's page.
+func targetURL(publicURL string, build *domain.Build) string {
+	return publicURL + "/builds/" + build.ID.String()
+}
+
+// validHMAC reports whether signature is the hex HMAC-SHA256 of payload
+// keyed with secret.
+func validHMAC(secret, signature string, payload []byte) bool {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+// repoPath extracts owner and repository name from a clone URL such as
+// https://github.com/owner/repo.git or git@github.com:owner/repo.git.
+func repoPath(repoURL string) (string, string, bool) {
+	p := repoURL
+	if u, err := url.Parse(repoURL); err == nil && u.Host != "" {
+		p = u.Path
+	} else if i := strings.Index(repoURL, ":"); i >= 0 {
+		// scp-like syntax: user@host:owner/repo
+		p = repoURL[i+1:]
+	}
+	parts := strings.Split(strings.Trim(strings.TrimSuffix(p, ".git"), "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// doJSON sends an API request with the given headers and decodes a
+// successful response into out.
+func doJSON(ctx context.Context, client *http.Client, method, url string, headers map[string]string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("User-Agent", "NanoCI")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: unexpected response %s", method, url, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// maxPushCommits is the most commits GitHub and GitLab list in a push
+// webhook; a push listing that many may well have had more.
+const maxPushCommits = 20
+
+// changedFiles lists every file touched by commits, once each. total is the
+// number of commits pushed, if the payload says. When commits are only part
+// of the push, the files are unknown and it returns nil.
+func changedFiles(commits []pushCommit, total int) []string {
+	if len(commits) >= maxPushCommits || total > len(commits) {
+		return nil
+	}
+	seen := make(map[string]bool)
+	files := []string{}
+	for _, c := range commits {
+		for _, list := range [][]string{c.Added, c.Removed, c.Modified} {
+			for _, f := range list {
+				if !seen[f] {
+					seen[f] = true
+					files = append(files, f)
+				}
+			}
+		}
+	}
+	return files
+}
+
+// pushCommit is a commit in a push webhook. GitHub, GitLab and Gitea all
+// describe them alike.
+type pushCommit struct {
+	ID       string   `json:"id"`
+	Message  string   `json:"message"`
+	Added    []string `json:"added"`
+	Removed  []string `json:"removed"`
+	Modified []string `json:"modified"`
+}
+
+// refBuild returns a build for a push of ref, filling in the branch or tag
+// and event, or nil for refs other than branches and tags. total is as for
+// changedFiles.
+func refBuild(ref string, commits []pushCommit, total int) *domain.Build {
+	switch {
+	case strings.HasPrefix(ref, "refs/heads/"):
+		return &domain.Build{
+			Branch:       strings.TrimPrefix(ref, "refs/heads/"),
+			Event:        domain.BuildEventPush,
+			ChangedFiles: changedFiles(commits, total),
+		}
+	case strings.HasPrefix(ref, "refs/tags/"):
+		return &domain.Build{
+			Tag:   strings.TrimPrefix(ref, "refs/tags/"),
+			Event: domain.BuildEventTag,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package scm
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/princetheprogrammerbtw/nanoci/internal/config"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+)
+
+type fakeProjectRepo struct {
+	domain.ProjectRepository
+	project *domain.Project
+}
+
+func (r *fakeProjectRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Project, error) {
+	return r.project, nil
+}
+
+// fakeProvider records the builds it is asked to report.
+type fakeProvider struct {
+	name     domain.SCMProvider
+	reported []*domain.Build
+}
+
+func (p *fakeProvider) Name() domain.SCMProvider                                      { return p.name }
+func (p *fakeProvider) RepoID(payload []byte) (string, error)                         { return "", nil }
+func (p *fakeProvider) Verify(header http.Header, payload []byte, secret string) bool { return false }
+func (p *fakeProvider) Event(header http.Header) string                               { return "" }
+func (p *fakeProvider) DeliveryID(header http.Header) string                          { return "" }
+func (p *fakeProvider) Build(event string, payload []byte) (*domain.Build, error)     { return nil, nil }
+func (p *fakeProvider) Report(ctx context.Context, project *domain.Project, build *domain.Build) error {
+	p.reported = append(p.reported, build)
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	r, err := NewRegistry(&fakeProjectRepo{}, &config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"github", "gitlab", "gitea"} {
+		if p := r.Get(name); p == nil || string(p.Name()) != name {
+			t.Errorf("Expected provider %s, got %v", name, p)
+		}
+	}
+	if r.Get("bitbucket") != nil {
+		t.Error("Expected no provider for bitbucket")
+	}
+
+	// Builds are reported through their project's provider
+	project := &domain.Project{ID: uuid.New(), Provider: domain.SCMProviderGitLab}
+	gitlab := &fakeProvider{name: domain.SCMProviderGitLab}
+	github := &fakeProvider{name: domain.SCMProviderGitHub}
+	r = &Registry{
+		projectRepo: &fakeProjectRepo{project: project},
+		providers:   map[domain.SCMProvider]Provider{gitlab.name: gitlab, github.name: github},
+	}
+	build := &domain.Build{ID: uuid.New(), ProjectID: project.ID, CommitHash: "abc123"}
+	if err := r.Report(context.Background(), build); err != nil {
+		t.Fatal(err)
+	}
+	if len(gitlab.reported) != 1 || len(github.reported) != 0 {
+		t.Errorf("Expected the build to be reported to gitlab only, got %d and %d", len(gitlab.reported), len(github.reported))
+	}
+}
+
+func TestDeliveryHeaders(t *testing.T) {
+	r, err := NewRegistry(&fakeProjectRepo{}, &config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		provider, eventHeader, deliveryHeader string
+	}{
+		{"github", "X-GitHub-Event", "X-GitHub-Delivery"},
+		{"gitlab", "X-Gitlab-Event", "X-Gitlab-Event-UUID"},
+		{"gitea", "X-Gitea-Event", "X-Gitea-Delivery"},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		header.Set(tt.eventHeader, "push")
+		header.Set(tt.deliveryHeader, "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+		p := r.Get(tt.provider)
+		if p.Event(header) != "push" || p.DeliveryID(header) != "72d3162e-cc78-11e3-81ab-4c9367dc0958" {
+			t.Errorf("%s: got event %q and delivery %q", tt.provider, p.Event(header), p.DeliveryID(header))
+		}
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	commits := []pushCommit{
+		{Added: []string{"a.go"}, Modified: []string{"b.go"}},
+		{Modified: []string{"a.go"}, Removed: []string{"c.go"}},
+	}
+	if got := changedFiles(commits, 0); len(got) != 3 {
+		t.Errorf("Expected 3 files, got %v", got)
+	}
+	if got := changedFiles(commits, 2); len(got) != 3 {
+		t.Errorf("Expected 3 files when every commit is listed, got %v", got)
+	}
+	if got := changedFiles(commits, 3); got != nil {
+		t.Errorf("Expected nil when commits are missing, got %v", got)
+	}
+	if got := changedFiles(make([]pushCommit, maxPushCommits), 0); got != nil {
+		t.Errorf("Expected nil for a push listing %d commits, got %v", maxPushCommits, got)
+	}
+	if got := changedFiles(nil, 0); got == nil || len(got) != 0 {
+		t.Errorf("Expected an empty list for a push without commits, got %v", got)
+	}
+}
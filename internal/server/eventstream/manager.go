@@ -0,0 +1,95 @@
+package eventstream
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/princetheprogrammerbtw/nanoci/internal/events"
+	"go.uber.org/zap"
+)
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// eventIDPattern matches the IDs the bus hands out, which double as cursors.
+var eventIDPattern = regexp.MustCompile(`^\d+(-\d+)?$`)
+
+type EventManager struct {
+	bus events.Bus
+}
+
+func NewEventManager(bus events.Bus) *EventManager {
+	return &EventManager{bus: bus}
+}
+
+// filter narrows the stream to one project or build; a zero ID matches all.
+type filter struct {
+	projectID uuid.UUID
+	buildID   uuid.UUID
+}
+
+func (f filter) match(e *events.Event) bool {
+	if f.projectID != uuid.Nil && e.ProjectID != f.projectID {
+		return false
+	}
+	if f.buildID != uuid.Nil && e.BuildID != f.buildID {
+		return false
+	}
+	return true
+}
+
+// HandleWS streams events as JSON, optionally filtered by ?project_id= and
+// ?build_id=. A client that reconnects passes the ID of the last event it saw
+// as ?since= to receive what it missed.
+func (m *EventManager) HandleWS(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	since := query.Get("since")
+	if since != "" && !eventIDPattern.MatchString(since) {
+		http.Error(w, "invalid since cursor", http.StatusBadRequest)
+		return
+	}
+	var f filter
+	for param, id := range map[string]*uuid.UUID{"project_id": &f.projectID, "build_id": &f.buildID} {
+		if v := query.Get(param); v != "" {
+			parsed, err := uuid.Parse(v)
+			if err != nil {
+				http.Error(w, "invalid "+param, http.StatusBadRequest)
+				return
+			}
+			*id = parsed
+		}
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		zap.L().Error("ws upgrade failed", zap.Error(err))
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Detect client disconnects
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for e := range m.bus.Subscribe(ctx, since) {
+		if !f.match(e) {
+			continue
+		}
+		if err := conn.WriteJSON(e); err != nil {
+			return
+		}
+	}
+}
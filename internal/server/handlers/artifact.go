@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/princetheprogrammerbtw/nanoci/internal/artifact"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"github.com/princetheprogrammerbtw/nanoci/pkg/response"
+)
+
+type ArtifactHandler struct {
+	buildRepo domain.BuildRepository
+	repo      domain.ArtifactRepository
+	store     artifact.Store
+}
+
+func NewArtifactHandler(br domain.BuildRepository, ar domain.ArtifactRepository, store artifact.Store) *ArtifactHandler {
+	return &ArtifactHandler{
+		buildRepo: br,
+		repo:      ar,
+		store:     store,
+	}
+}
+
+// List returns the artifacts of a build that have not expired yet.
+func (h *ArtifactHandler) List(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid build id")
+		return
+	}
+
+	build, err := h.buildRepo.GetByID(r.Context(), id)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if build == nil {
+		response.Error(w, http.StatusNotFound, "build not found")
+		return
+	}
+
+	artifacts, err := h.repo.ListByBuildID(r.Context(), build.ID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	now := time.Now()
+	live := []*domain.Artifact{}
+	for _, a := range artifacts {
+		if a.ExpiresAt.After(now) {
+			live = append(live, a)
+		}
+	}
+	response.JSON(w, http.StatusOK, live)
+}
+
+// Download serves the contents of one artifact as an attachment. Range
+// requests are honoured so large artifacts can be resumed.
+func (h *ArtifactHandler) Download(w http.ResponseWriter, r *http.Request) {
+	buildID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid build id")
+		return
+	}
+	artifactID, err := uuid.Parse(chi.URLParam(r, "artifactID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid artifact id")
+		return
+	}
+
+	a, err := h.repo.GetByID(r.Context(), artifactID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if a == nil || a.BuildID != buildID || !a.ExpiresAt.After(time.Now()) {
+		response.Error(w, http.StatusNotFound, "artifact not found")
+		return
+	}
+
+	f, err := h.store.Open(r.Context(), a.Digest)
+	if errors.Is(err, artifact.ErrNotFound) {
+		response.Error(w, http.StatusNotFound, "artifact not found")
+		return
+	}
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(a.Path)}))
+	w.Header().Set("ETag", `"`+a.Digest+`"`)
+	http.ServeContent(w, r, "", a.CreatedAt, f)
+}
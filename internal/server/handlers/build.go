@@ -1,20 +1,31 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"github.com/princetheprogrammerbtw/nanoci/internal/events"
+	"github.com/princetheprogrammerbtw/nanoci/internal/notify"
+	"github.com/princetheprogrammerbtw/nanoci/internal/queue"
+	"github.com/princetheprogrammerbtw/nanoci/internal/status"
 	"github.com/princetheprogrammerbtw/nanoci/pkg/response"
 )
 
 type BuildHandler struct {
-	repo domain.BuildRepository
+	repo     domain.BuildRepository
+	stepRepo domain.StepRepository
+	queue    *queue.RedisQueue
+	events   events.Bus
+	reporter status.Reporter
+	notifier *notify.Notifier
 }
 
-func NewBuildHandler(repo domain.BuildRepository) *BuildHandler {
-	return &BuildHandler{repo: repo}
+func NewBuildHandler(repo domain.BuildRepository, stepRepo domain.StepRepository, q *queue.RedisQueue, bus events.Bus, rep status.Reporter, n *notify.Notifier) *BuildHandler {
+	return &BuildHandler{repo: repo, stepRepo: stepRepo, queue: q, events: bus, reporter: rep, notifier: n}
 }
 
 func (h *BuildHandler) ListByProject(w http.ResponseWriter, r *http.Request) {
@@ -54,3 +65,155 @@ func (h *BuildHandler) Get(w http.ResponseWriter, r *http.Request) {
 
 	response.JSON(w, http.StatusOK, build)
 }
+
+func (h *BuildHandler) ListSteps(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid build id")
+		return
+	}
+
+	build, err := h.repo.GetByID(r.Context(), id)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if build == nil {
+		response.Error(w, http.StatusNotFound, "build not found")
+		return
+	}
+
+	steps, err := h.stepRepo.ListByBuildID(r.Context(), id)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.JSON(w, http.StatusOK, steps)
+}
+
+// ListChildren lists the builds a matrix build expanded into.
+func (h *BuildHandler) ListChildren(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid build id")
+		return
+	}
+
+	children, err := h.repo.ListByParentID(r.Context(), id)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.JSON(w, http.StatusOK, children)
+}
+
+// Cancel stops a build. Pending builds are pulled from the queue and finished
+// immediately; running builds are signalled to their worker, which records
+// the CANCELLED outcome once the container has been torn down. Cancelling a
+// matrix build cancels all of its children.
+func (h *BuildHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid build id")
+		return
+	}
+
+	build, err := h.repo.GetByID(r.Context(), id)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if build == nil {
+		response.Error(w, http.StatusNotFound, "build not found")
+		return
+	}
+
+	status, err := h.cancel(r.Context(), build)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if status == http.StatusConflict {
+		response.Error(w, status, "build has already finished")
+		return
+	}
+
+	children, err := h.repo.ListByParentID(r.Context(), build.ID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, child := range children {
+		if _, err := h.cancel(r.Context(), child); err != nil {
+			response.Error(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	// Cancelling the last pending child may have finished the parent
+	if updated, err := h.repo.GetByID(r.Context(), build.ID); err == nil && updated != nil {
+		build = updated
+	}
+	response.JSON(w, status, build)
+}
+
+// cancel stops a single build and returns the status code describing the
+// outcome: 200 if it was cancelled, 202 if its worker was asked to stop it,
+// 409 if it had already finished.
+func (h *BuildHandler) cancel(ctx context.Context, build *domain.Build) (int, error) {
+	switch build.Status {
+	case domain.BuildStatusPending:
+		if _, err := h.queue.Remove(ctx, build.ID.String()); err != nil {
+			return 0, err
+		}
+		finishTime := time.Now()
+		build.Status = domain.BuildStatusCancelled
+		build.FinishedAt = &finishTime
+		cancelled, err := h.repo.UpdateStatus(ctx, build, domain.BuildStatusPending)
+		if err != nil {
+			return 0, err
+		}
+		if !cancelled {
+			// A worker started the build in the meantime
+			current, err := h.repo.GetByID(ctx, build.ID)
+			if err != nil || current == nil {
+				return 0, err
+			}
+			*build = *current
+			return h.cancel(ctx, build)
+		}
+		h.finished(ctx, build)
+		parent, err := domain.FinishParent(ctx, h.repo, build)
+		if err != nil {
+			return 0, err
+		}
+		if parent != nil {
+			h.finished(ctx, parent)
+		}
+		return http.StatusOK, nil
+	case domain.BuildStatusRunning:
+		// The flag reaches the worker even if it misses the message, and the
+		// reaper if the worker is gone
+		if err := h.repo.RequestCancel(ctx, build.ID); err != nil {
+			return 0, err
+		}
+		build.CancelRequested = true
+		if err := h.queue.Cancel(ctx, build.ID.String()); err != nil {
+			return 0, err
+		}
+		return http.StatusAccepted, nil
+	default:
+		return http.StatusConflict, nil
+	}
+}
+
+func (h *BuildHandler) finished(ctx context.Context, build *domain.Build) {
+	events.Emit(ctx, h.events, events.BuildFinished, build, nil)
+	status.Update(ctx, h.reporter, build)
+	h.notifier.Notify(ctx, build)
+}
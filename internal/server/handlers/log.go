@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"github.com/princetheprogrammerbtw/nanoci/internal/logstore"
+	"github.com/princetheprogrammerbtw/nanoci/pkg/response"
+)
+
+type LogHandler struct {
+	buildRepo domain.BuildRepository
+	stepRepo  domain.StepRepository
+	store     logstore.Store
+}
+
+func NewLogHandler(br domain.BuildRepository, sr domain.StepRepository, store logstore.Store) *LogHandler {
+	return &LogHandler{
+		buildRepo: br,
+		stepRepo:  sr,
+		store:     store,
+	}
+}
+
+// Get replays the persisted log of a build as JSON Lines. With ?step= only that
+// step is returned; otherwise the setup log and all steps are concatenated in
+// pipeline order.
+// Range requests are honoured so clients can resume partial downloads.
+func (h *LogHandler) Get(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid build id")
+		return
+	}
+
+	build, err := h.buildRepo.GetByID(r.Context(), id)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if build == nil {
+		response.Error(w, http.StatusNotFound, "build not found")
+		return
+	}
+
+	var content io.ReadSeeker
+	if step := r.URL.Query().Get("step"); step != "" {
+		f, err := h.store.Open(r.Context(), build.ID.String(), step)
+		if errors.Is(err, logstore.ErrNotFound) {
+			response.Error(w, http.StatusNotFound, "log not found")
+			return
+		}
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		defer f.Close()
+		content = f
+	} else {
+		steps, err := h.stepRepo.ListByBuildID(r.Context(), build.ID)
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		names := []string{logstore.SetupLog}
+		for _, s := range steps {
+			names = append(names, s.Name)
+		}
+
+		var buf bytes.Buffer
+		for _, name := range names {
+			f, err := h.store.Open(r.Context(), build.ID.String(), name)
+			if errors.Is(err, logstore.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				response.Error(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			_, err = io.Copy(&buf, f)
+			f.Close()
+			if err != nil {
+				response.Error(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+		content = bytes.NewReader(buf.Bytes())
+	}
+
+	var modTime time.Time
+	if build.FinishedAt != nil {
+		modTime = *build.FinishedAt
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	http.ServeContent(w, r, "", modTime, content)
+}
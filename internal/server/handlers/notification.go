@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"github.com/princetheprogrammerbtw/nanoci/pkg/crypto"
+	"github.com/princetheprogrammerbtw/nanoci/pkg/response"
+)
+
+const (
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 500
+)
+
+type NotificationHandler struct {
+	repo          domain.NotificationRepository
+	encryptionKey []byte
+}
+
+func NewNotificationHandler(repo domain.NotificationRepository, key string) *NotificationHandler {
+	return &NotificationHandler{
+		repo:          repo,
+		encryptionKey: []byte(key),
+	}
+}
+
+func (h *NotificationHandler) List(w http.ResponseWriter, r *http.Request) {
+	projectID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid project id")
+		return
+	}
+
+	targets, err := h.repo.ListTargetsByProjectID(r.Context(), projectID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if targets == nil {
+		targets = []*domain.NotificationTarget{}
+	}
+
+	response.JSON(w, http.StatusOK, targets)
+}
+
+// Create adds a notification target. Its signing secret is generated unless
+// one is given, and is only ever returned in this response.
+func (h *NotificationHandler) Create(w http.ResponseWriter, r *http.Request) {
+	projectID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid project id")
+		return
+	}
+
+	var req struct {
+		Kind       domain.NotificationKind `json:"kind"`
+		URL        string                  `json:"url"`
+		Recipients []string                `json:"recipients"`
+		On         domain.NotifyOn         `json:"on"`
+		Branches   []string                `json:"branches"`
+		Secret     string                  `json:"secret"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	target := &domain.NotificationTarget{
+		ProjectID:  projectID,
+		Kind:       req.Kind,
+		URL:        req.URL,
+		Recipients: req.Recipients,
+		On:         req.On,
+		Branches:   req.Branches,
+	}
+	if err := target.Validate(); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		if secret, err = generateSecret(); err != nil {
+			response.Error(w, http.StatusInternalServerError, "failed to generate secret")
+			return
+		}
+	}
+	target.EncryptedSecret, err = crypto.Encrypt(secret, h.encryptionKey)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "encryption failed")
+		return
+	}
+
+	if err := h.repo.CreateTarget(r.Context(), target); err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.JSON(w, http.StatusCreated, struct {
+		*domain.NotificationTarget
+		Secret string `json:"secret"`
+	}{target, secret})
+}
+
+func (h *NotificationHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	projectID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid project id")
+		return
+	}
+	targetID, err := uuid.Parse(chi.URLParam(r, "targetID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid target id")
+		return
+	}
+
+	if err := h.repo.DeleteTarget(r.Context(), projectID, targetID); err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Deliveries lists the project's most recent deliveries, newest first; ?limit=
+// sets how many.
+func (h *NotificationHandler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	projectID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid project id")
+		return
+	}
+
+	limit := defaultDeliveryLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxDeliveryLimit {
+			response.Error(w, http.StatusBadRequest, "limit must be between 1 and 500")
+			return
+		}
+	}
+
+	deliveries, err := h.repo.ListDeliveriesByProjectID(r.Context(), projectID, limit)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if deliveries == nil {
+		deliveries = []*domain.NotificationDelivery{}
+	}
+
+	response.JSON(w, http.StatusOK, deliveries)
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"github.com/princetheprogrammerbtw/nanoci/pkg/response"
+)
+
+// maxPipelineSize bounds the documents accepted for validation.
+const maxPipelineSize = 1 << 20
+
+type PipelineHandler struct{}
+
+func NewPipelineHandler() *PipelineHandler {
+	return &PipelineHandler{}
+}
+
+type validateResponse struct {
+	Valid  bool                     `json:"valid"`
+	Errors []domain.ValidationError `json:"errors"`
+}
+
+// Validate checks a .nanoci.yml document sent as the request body and lists
+// every problem found, each with its line and column.
+func (h *PipelineHandler) Validate(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPipelineSize))
+	if err != nil {
+		response.Error(w, http.StatusRequestEntityTooLarge, "pipeline is too large")
+		return
+	}
+
+	_, errs := domain.ValidatePipeline(data)
+	if errs == nil {
+		errs = domain.ValidationErrors{}
+	}
+	response.JSON(w, http.StatusOK, validateResponse{Valid: len(errs) == 0, Errors: errs})
+}
+
+// Schema serves the JSON Schema of .nanoci.yml for editors.
+func (h *PipelineHandler) Schema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(domain.PipelineSchema)
+}
@@ -1,21 +1,29 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"github.com/princetheprogrammerbtw/nanoci/pkg/crypto"
 	"github.com/princetheprogrammerbtw/nanoci/pkg/response"
 )
 
 type ProjectHandler struct {
-	repo domain.ProjectRepository
+	repo          domain.ProjectRepository
+	encryptionKey []byte
 }
 
-func NewProjectHandler(repo domain.ProjectRepository) *ProjectHandler {
-	return &ProjectHandler{repo: repo}
+func NewProjectHandler(repo domain.ProjectRepository, key string) *ProjectHandler {
+	return &ProjectHandler{
+		repo:          repo,
+		encryptionKey: []byte(key),
+	}
 }
 
 func (h *ProjectHandler) List(w http.ResponseWriter, r *http.Request) {
@@ -80,11 +88,155 @@ func (h *ProjectHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 	userID, _ := uuid.Parse(userIDStr)
 	p.UserID = userID
+	if p.Provider == "" {
+		p.Provider = domain.SCMProviderGitHub
+	}
+	if !p.Provider.Valid() {
+		response.Error(w, http.StatusBadRequest, "provider must be github, gitlab or gitea")
+		return
+	}
+	// Credentials are only ever set through SetCredential
+	p.CredentialType = domain.CredentialTypeNone
+	secret, err := generateSecret()
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to generate webhook secret")
+		return
+	}
+	p.WebhookSecret = secret
 
 	if err := h.repo.Create(r.Context(), &p); err != nil {
 		response.Error(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	response.JSON(w, http.StatusCreated, p)
+	response.JSON(w, http.StatusCreated, withWebhookSecret(&p))
+}
+
+// RotateWebhookSecret replaces the secret the provider's webhooks are
+// verified with. The new secret is only ever returned in this response;
+// deliveries signed with the old one are rejected from now on.
+func (h *ProjectHandler) RotateWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	project, ok := h.project(w, r)
+	if !ok {
+		return
+	}
+
+	secret, err := generateSecret()
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "failed to generate webhook secret")
+		return
+	}
+	project.WebhookSecret = secret
+	if err := h.repo.UpdateWebhookSecret(r.Context(), project); err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.JSON(w, http.StatusOK, withWebhookSecret(project))
+}
+
+// withWebhookSecret shows the project together with its webhook secret,
+// which is otherwise never serialized.
+func withWebhookSecret(p *domain.Project) interface{} {
+	return struct {
+		*domain.Project
+		WebhookSecret string `json:"webhook_secret"`
+	}{p, p.WebhookSecret}
+}
+
+// generateSecret returns 32 random bytes, hex encoded, for signing webhooks.
+func generateSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// SetCredential stores the credentials the worker uses to clone a private
+// repository: either an HTTPS token or an SSH deploy key. The value is
+// encrypted at rest and never returned by the API.
+func (h *ProjectHandler) SetCredential(w http.ResponseWriter, r *http.Request) {
+	project, ok := h.project(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Type  domain.CredentialType `json:"type"`
+		Value string                `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	switch req.Type {
+	case domain.CredentialTypeToken:
+		req.Value = strings.TrimSpace(req.Value)
+		if req.Value == "" {
+			response.Error(w, http.StatusBadRequest, "token must not be empty")
+			return
+		}
+	case domain.CredentialTypeSSHKey:
+		if !strings.Contains(req.Value, "PRIVATE KEY") {
+			response.Error(w, http.StatusBadRequest, "value must be a PEM encoded private key")
+			return
+		}
+	default:
+		response.Error(w, http.StatusBadRequest, "type must be token or ssh_key")
+		return
+	}
+
+	encrypted, err := crypto.Encrypt(req.Value, h.encryptionKey)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "encryption failed")
+		return
+	}
+
+	project.CredentialType = req.Type
+	project.EncryptedCredential = encrypted
+	if err := h.repo.UpdateCredential(r.Context(), project); err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.JSON(w, http.StatusOK, project)
+}
+
+func (h *ProjectHandler) DeleteCredential(w http.ResponseWriter, r *http.Request) {
+	project, ok := h.project(w, r)
+	if !ok {
+		return
+	}
+
+	project.CredentialType = domain.CredentialTypeNone
+	project.EncryptedCredential = ""
+	if err := h.repo.UpdateCredential(r.Context(), project); err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// project loads the project named by the {id} URL parameter, writing the
+// error response itself when it cannot.
+func (h *ProjectHandler) project(w http.ResponseWriter, r *http.Request) (*domain.Project, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid project id")
+		return nil, false
+	}
+
+	project, err := h.repo.GetByID(r.Context(), id)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if project == nil {
+		response.Error(w, http.StatusNotFound, "project not found")
+		return nil, false
+	}
+	return project, true
 }
@@ -1,48 +1,66 @@
 package handlers
 
 import (
-	"crypto/hmac"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
-	"strings"
+	"strconv"
+	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"github.com/princetheprogrammerbtw/nanoci/internal/events"
 	"github.com/princetheprogrammerbtw/nanoci/internal/queue"
+	"github.com/princetheprogrammerbtw/nanoci/internal/scm"
+	"github.com/princetheprogrammerbtw/nanoci/internal/status"
+	"github.com/princetheprogrammerbtw/nanoci/pkg/response"
 	"go.uber.org/zap"
 )
 
+// pendingDeliveryLease is how long a delivery may stay pending before a
+// retry of it is evaluated again, in case its evaluation was cut short by a
+// crash. Evaluating a delivery takes well under a second.
+const pendingDeliveryLease = time.Minute
+
+// jobQueue is the part of the job queue that triggering builds needs.
+type jobQueue interface {
+	Enqueue(ctx context.Context, job *queue.Job) error
+}
+
 type WebhookHandler struct {
-	projectRepo domain.ProjectRepository
-	buildRepo   domain.BuildRepository
-	queue       *queue.RedisQueue
+	projectRepo  domain.ProjectRepository
+	buildRepo    domain.BuildRepository
+	deliveryRepo domain.WebhookDeliveryRepository
+	queue        jobQueue
+	events       events.Bus
+	providers    *scm.Registry
 }
 
-func NewWebhookHandler(p domain.ProjectRepository, b domain.BuildRepository, q *queue.RedisQueue) *WebhookHandler {
+func NewWebhookHandler(p domain.ProjectRepository, b domain.BuildRepository, d domain.WebhookDeliveryRepository, q jobQueue, bus events.Bus, providers *scm.Registry) *WebhookHandler {
 	return &WebhookHandler{
-		projectRepo: p,
-		buildRepo:   b,
-		queue:       q,
+		projectRepo:  p,
+		buildRepo:    b,
+		deliveryRepo: d,
+		queue:        q,
+		events:       bus,
+		providers:    providers,
 	}
 }
 
-type githubPushPayload struct {
-	Ref        string `json:"ref"`
-	After      string `json:"after"`
-	Repository struct {
-		ID   int64  `json:"id"`
-		Name string `json:"full_name"`
-	} `json:"repository"`
-	HeadCommit struct {
-		Message string `json:"message"`
-		ID      string `json:"id"`
-	} `json:"head_commit"`
-}
+// Handle receives a webhook from the provider named in the URL, such as
+// /webhooks/gitlab, records it and triggers the build it asks for. Retries
+// of a delivery that was already acted on, or is being acted on, are
+// acknowledged and dropped.
+func (h *WebhookHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	provider := h.providers.Get(chi.URLParam(r, "provider"))
+	if provider == nil {
+		http.Error(w, "unknown provider", http.StatusNotFound)
+		return
+	}
 
-func (h *WebhookHandler) HandleGithub(w http.ResponseWriter, r *http.Request) {
 	payload, err := io.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, "failed to read body", http.StatusBadRequest)
@@ -50,68 +68,196 @@ func (h *WebhookHandler) HandleGithub(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	// In production, verify signature here using hmac with project.WebhookSecret
-	// For now, we'll skip or log it.
-
-	var event githubPushPayload
-	if err := json.Unmarshal(payload, &event); err != nil {
-		zap.L().Error("failed to unmarshal github payload", zap.Error(err))
+	repoID, err := provider.RepoID(payload)
+	if err != nil {
+		zap.L().Error("failed to unmarshal webhook payload", zap.String("provider", string(provider.Name())), zap.Error(err))
 		http.Error(w, "invalid payload", http.StatusBadRequest)
 		return
 	}
-
-	// Only handle push to branches (not tags)
-	if !strings.HasPrefix(event.Ref, "refs/heads/") {
-		w.WriteHeader(http.StatusNoContent)
-		return
-	}
-	branch := strings.TrimPrefix(event.Ref, "refs/heads/")
-
-	repoID := fmt.Sprintf("%d", event.Repository.ID)
-	project, err := h.projectRepo.GetByGithubRepoID(r.Context(), repoID)
+	project, err := h.projectRepo.GetByRepoID(r.Context(), provider.Name(), repoID)
 	if err != nil {
 		zap.L().Error("failed to find project", zap.Error(err))
 		http.Error(w, "project not found", http.StatusNotFound)
 		return
 	}
 	if project == nil {
-		zap.L().Warn("received webhook for unknown project", zap.Int64("repo_id", event.Repository.ID))
+		zap.L().Warn("received webhook for unknown project", zap.String("provider", string(provider.Name())), zap.String("repo_id", repoID))
 		http.Error(w, "project not found", http.StatusNotFound)
 		return
 	}
 
-	build := &domain.Build{
-		ProjectID:     project.ID,
-		CommitHash:    event.HeadCommit.ID,
-		CommitMessage: event.HeadCommit.Message,
-		Branch:        branch,
-		Status:        domain.BuildStatusPending,
+	// Nothing in the payload can be trusted until it is known to come from
+	// the provider. A project without a secret cannot tell, so it rejects
+	// everything.
+	if project.WebhookSecret == "" || !provider.Verify(r.Header, payload, project.WebhookSecret) {
+		zap.L().Warn("rejected webhook with invalid signature", zap.String("project", project.Name))
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
 	}
 
-	if err := h.buildRepo.Create(r.Context(), build); err != nil {
-		zap.L().Error("failed to create build", zap.Error(err))
-		http.Error(w, "failed to trigger build", http.StatusInternalServerError)
+	hash := sha256.Sum256(payload)
+	delivery := &domain.WebhookDelivery{
+		ProjectID:   project.ID,
+		DeliveryID:  provider.DeliveryID(r.Header),
+		Event:       provider.Event(r.Header),
+		PayloadHash: hex.EncodeToString(hash[:]),
+		Payload:     payload,
+		Outcome:     domain.WebhookOutcomePending,
+	}
+	created, err := h.deliveryRepo.Create(r.Context(), delivery)
+	if err != nil {
+		zap.L().Error("failed to record webhook delivery", zap.Error(err))
+		http.Error(w, "failed to record delivery", http.StatusInternalServerError)
 		return
 	}
+	if !created {
+		// A retry. Only one whose build could not be created, or whose
+		// evaluation never finished, is tried again.
+		existing, err := h.deliveryRepo.GetByDeliveryID(r.Context(), project.ID, delivery.DeliveryID)
+		if err != nil || existing == nil {
+			zap.L().Error("failed to find webhook delivery", zap.String("delivery_id", delivery.DeliveryID), zap.Error(err))
+			http.Error(w, "failed to record delivery", http.StatusInternalServerError)
+			return
+		}
+		retry, err := h.deliveryRepo.Retry(r.Context(), existing.ID, pendingDeliveryLease)
+		if err != nil {
+			zap.L().Error("failed to retry webhook delivery", zap.String("delivery_id", delivery.DeliveryID), zap.Error(err))
+			http.Error(w, "failed to record delivery", http.StatusInternalServerError)
+			return
+		}
+		if !retry {
+			zap.L().Info("dropped duplicate webhook delivery", zap.String("project", project.Name), zap.String("delivery_id", delivery.DeliveryID))
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		delivery = existing
+	}
+
+	w.WriteHeader(h.trigger(r.Context(), provider, project, delivery))
+}
+
+// trigger evaluates a recorded delivery, creates and queues the build it
+// asks for and records the outcome. It returns the HTTP status describing
+// the outcome.
+func (h *WebhookHandler) trigger(ctx context.Context, provider scm.Provider, project *domain.Project, d *domain.WebhookDelivery) int {
+	code := http.StatusAccepted
+	d.Error = ""
+	build, err := provider.Build(d.Event, d.Payload)
+	switch {
+	case err != nil:
+		zap.L().Error("failed to unmarshal webhook payload", zap.String("provider", string(provider.Name())), zap.Error(err))
+		d.Outcome, d.Error, code = domain.WebhookOutcomeInvalid, err.Error(), http.StatusBadRequest
+	case build == nil:
+		// pings and events we don't build for
+		d.Outcome, code = domain.WebhookOutcomeIgnored, http.StatusNoContent
+	default:
+		build.ProjectID = project.ID
+		build.Status = domain.BuildStatusPending
+		if err := h.buildRepo.Create(ctx, build); err != nil {
+			zap.L().Error("failed to create build", zap.Error(err))
+			d.Outcome, d.Error, code = domain.WebhookOutcomeFailed, err.Error(), http.StatusInternalServerError
+			break
+		}
 
-	if err := h.queue.Enqueue(r.Context(), &queue.Job{BuildID: build.ID.String()}); err != nil {
-		zap.L().Error("failed to enqueue job", zap.Error(err))
-		// We might want to mark build as failed here
+		if err := h.queue.Enqueue(ctx, &queue.Job{BuildID: build.ID.String()}); err != nil {
+			zap.L().Error("failed to enqueue job", zap.Error(err))
+			// We might want to mark build as failed here
+		}
+		events.Emit(ctx, h.events, events.BuildQueued, build, nil)
+		status.Update(ctx, h.providers, build)
+
+		zap.L().Info("build triggered", zap.String("project", project.Name), zap.String("event", string(build.Event)), zap.String("commit", build.CommitHash))
+		d.Outcome, d.BuildID = domain.WebhookOutcomeTriggered, &build.ID
 	}
 
-	zap.L().Info("build triggered", zap.String("project", project.Name), zap.String("commit", build.CommitHash))
-	w.WriteHeader(http.StatusAccepted)
+	if err := h.deliveryRepo.UpdateOutcome(ctx, d); err != nil {
+		zap.L().Error("failed to record webhook outcome", zap.String("delivery", d.ID.String()), zap.Error(err))
+	}
+	return code
 }
 
-func verifySignature(secret, signature string, payload []byte) bool {
-	if !strings.HasPrefix(signature, "sha256=") {
-		return false
-	}
-	signature = strings.TrimPrefix(signature, "sha256=")
-	
-	mac := hmac.New(sha256.New, []byte(secret))
-	mac.Write(payload)
-	expectedMAC := hex.EncodeToString(mac.Sum(nil))
-	
-	return hmac.Equal([]byte(signature), []byte(expectedMAC))
+// Deliveries lists the project's most recent webhook deliveries, newest
+// first; ?limit= sets how many.
+func (h *WebhookHandler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	projectID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid project id")
+		return
+	}
+
+	limit := defaultDeliveryLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxDeliveryLimit {
+			response.Error(w, http.StatusBadRequest, "limit must be between 1 and 500")
+			return
+		}
+	}
+
+	deliveries, err := h.deliveryRepo.ListByProjectID(r.Context(), projectID, limit)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if deliveries == nil {
+		deliveries = []*domain.WebhookDelivery{}
+	}
+
+	response.JSON(w, http.StatusOK, deliveries)
+}
+
+// Redeliver evaluates a stored delivery's payload again, as if it had just
+// arrived, and records the result as a new delivery pointing back at it.
+// Only verified deliveries are stored, so the payload is not checked again.
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	projectID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid project id")
+		return
+	}
+	deliveryID, err := uuid.Parse(chi.URLParam(r, "deliveryID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid delivery id")
+		return
+	}
+
+	original, err := h.deliveryRepo.GetByID(r.Context(), deliveryID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if original == nil || original.ProjectID != projectID {
+		response.Error(w, http.StatusNotFound, "delivery not found")
+		return
+	}
+	project, err := h.projectRepo.GetByID(r.Context(), projectID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if project == nil {
+		response.Error(w, http.StatusNotFound, "project not found")
+		return
+	}
+	provider := h.providers.Get(string(project.Provider))
+	if provider == nil {
+		response.Error(w, http.StatusUnprocessableEntity, "project has no known provider")
+		return
+	}
+
+	delivery := &domain.WebhookDelivery{
+		ProjectID:    projectID,
+		Event:        original.Event,
+		PayloadHash:  original.PayloadHash,
+		Payload:      original.Payload,
+		Outcome:      domain.WebhookOutcomePending,
+		RedeliveryOf: &original.ID,
+	}
+	if _, err := h.deliveryRepo.Create(r.Context(), delivery); err != nil {
+		response.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.trigger(r.Context(), provider, project, delivery)
+
+	response.JSON(w, http.StatusCreated, delivery)
 }
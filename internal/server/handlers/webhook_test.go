@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/princetheprogrammerbtw/nanoci/internal/config"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"github.com/princetheprogrammerbtw/nanoci/internal/events"
+	"github.com/princetheprogrammerbtw/nanoci/internal/queue"
+	"github.com/princetheprogrammerbtw/nanoci/internal/scm"
+)
+
+type fakeProjectRepo struct {
+	domain.ProjectRepository
+	project *domain.Project
+}
+
+func (r *fakeProjectRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Project, error) {
+	if id != r.project.ID {
+		return nil, nil
+	}
+	return r.project, nil
+}
+
+func (r *fakeProjectRepo) GetByRepoID(ctx context.Context, provider domain.SCMProvider, repoID string) (*domain.Project, error) {
+	if provider != r.project.Provider || repoID != r.project.RepoID {
+		return nil, nil
+	}
+	return r.project, nil
+}
+
+// fakeBuildRepo fails to create builds while err is set.
+type fakeBuildRepo struct {
+	domain.BuildRepository
+	created []*domain.Build
+	err     error
+}
+
+func (r *fakeBuildRepo) Create(ctx context.Context, build *domain.Build) error {
+	if r.err != nil {
+		return r.err
+	}
+	build.ID = uuid.New()
+	r.created = append(r.created, build)
+	return nil
+}
+
+// fakeDeliveryRepo keeps deliveries in memory, along with when each was last
+// claimed for evaluation.
+type fakeDeliveryRepo struct {
+	domain.WebhookDeliveryRepository
+	mu         sync.Mutex
+	deliveries []*domain.WebhookDelivery
+	attempted  map[uuid.UUID]time.Time
+}
+
+func (r *fakeDeliveryRepo) Create(ctx context.Context, d *domain.WebhookDelivery) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.deliveries {
+		if d.DeliveryID != "" && existing.ProjectID == d.ProjectID && existing.DeliveryID == d.DeliveryID {
+			return false, nil
+		}
+	}
+	d.ID, d.CreatedAt = uuid.New(), time.Now()
+	c := *d
+	r.deliveries = append(r.deliveries, &c)
+	r.attempted[d.ID] = d.CreatedAt
+	return true, nil
+}
+
+func (r *fakeDeliveryRepo) get(match func(*domain.WebhookDelivery) bool) *domain.WebhookDelivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range r.deliveries {
+		if match(d) {
+			c := *d
+			return &c
+		}
+	}
+	return nil
+}
+
+func (r *fakeDeliveryRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.WebhookDelivery, error) {
+	return r.get(func(d *domain.WebhookDelivery) bool { return d.ID == id }), nil
+}
+
+func (r *fakeDeliveryRepo) GetByDeliveryID(ctx context.Context, projectID uuid.UUID, deliveryID string) (*domain.WebhookDelivery, error) {
+	return r.get(func(d *domain.WebhookDelivery) bool { return d.ProjectID == projectID && d.DeliveryID == deliveryID }), nil
+}
+
+func (r *fakeDeliveryRepo) Retry(ctx context.Context, id uuid.UUID, lease time.Duration) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range r.deliveries {
+		if d.ID != id {
+			continue
+		}
+		stale := d.Outcome == domain.WebhookOutcomePending && time.Since(r.attempted[id]) > lease
+		if d.Outcome != domain.WebhookOutcomeFailed && !stale {
+			return false, nil
+		}
+		d.Outcome, d.Error = domain.WebhookOutcomePending, ""
+		r.attempted[id] = time.Now()
+		return true, nil
+	}
+	return false, nil
+}
+
+func (r *fakeDeliveryRepo) UpdateOutcome(ctx context.Context, d *domain.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, existing := range r.deliveries {
+		if existing.ID == d.ID {
+			c := *d
+			r.deliveries[i] = &c
+		}
+	}
+	return nil
+}
+
+type fakeQueue struct {
+	jobs []*queue.Job
+}
+
+func (q *fakeQueue) Enqueue(ctx context.Context, job *queue.Job) error {
+	q.jobs = append(q.jobs, job)
+	return nil
+}
+
+type fakeBus struct {
+	events.Bus
+}
+
+func (b *fakeBus) Publish(ctx context.Context, e *events.Event) error {
+	return nil
+}
+
+type webhookFixture struct {
+	router     chi.Router
+	project    *domain.Project
+	builds     *fakeBuildRepo
+	deliveries *fakeDeliveryRepo
+	queue      *fakeQueue
+}
+
+func newWebhookFixture(t *testing.T) *webhookFixture {
+	project := &domain.Project{
+		ID:            uuid.New(),
+		Name:          "app",
+		Provider:      domain.SCMProviderGitLab,
+		RepoID:        "15",
+		WebhookSecret: "s3cret",
+	}
+	f := &webhookFixture{
+		project:    project,
+		builds:     &fakeBuildRepo{},
+		deliveries: &fakeDeliveryRepo{attempted: make(map[uuid.UUID]time.Time)},
+		queue:      &fakeQueue{},
+	}
+	projects := &fakeProjectRepo{project: project}
+	providers, err := scm.NewRegistry(projects, &config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewWebhookHandler(projects, f.builds, f.deliveries, f.queue, &fakeBus{}, providers)
+
+	f.router = chi.NewRouter()
+	f.router.Post("/webhooks/{provider}", h.Handle)
+	f.router.Post("/projects/{id}/webhook-deliveries/{deliveryID}/redeliver", h.Redeliver)
+	return f
+}
+
+const pushPayload = `{"ref": "refs/heads/main", "after": "abc123", "checkout_sha": "abc123", "project": {"id": 15}, "commits": []}`
+
+// push sends a GitLab push to main with the given delivery ID.
+func (f *webhookFixture) push(deliveryID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/gitlab", strings.NewReader(pushPayload))
+	req.Header.Set("X-Gitlab-Token", "s3cret")
+	req.Header.Set("X-Gitlab-Event", "Push Hook")
+	req.Header.Set("X-Gitlab-Event-UUID", deliveryID)
+	rec := httptest.NewRecorder()
+	f.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func (f *webhookFixture) delivery(deliveryID string) *domain.WebhookDelivery {
+	d, _ := f.deliveries.GetByDeliveryID(context.Background(), f.project.ID, deliveryID)
+	return d
+}
+
+func TestWebhookDropsDuplicateDeliveries(t *testing.T) {
+	f := newWebhookFixture(t)
+
+	if rec := f.push("delivery-1"); rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d", rec.Code)
+	}
+	if rec := f.push("delivery-1"); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 for a duplicate, got %d", rec.Code)
+	}
+	if len(f.builds.created) != 1 || len(f.queue.jobs) != 1 {
+		t.Errorf("Expected one build and job, got %d and %d", len(f.builds.created), len(f.queue.jobs))
+	}
+	if d := f.delivery("delivery-1"); d.Outcome != domain.WebhookOutcomeTriggered || *d.BuildID != f.builds.created[0].ID {
+		t.Errorf("Expected the delivery to record its build, got %+v", d)
+	}
+
+	// A different delivery of the same payload is not a duplicate
+	if rec := f.push("delivery-2"); rec.Code != http.StatusAccepted || len(f.builds.created) != 2 {
+		t.Errorf("Expected a second build, got %d and %d builds", rec.Code, len(f.builds.created))
+	}
+}
+
+func TestWebhookRetriesFailedDeliveries(t *testing.T) {
+	f := newWebhookFixture(t)
+
+	f.builds.err = errors.New("database is down")
+	if rec := f.push("delivery-1"); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected 500, got %d", rec.Code)
+	}
+	if d := f.delivery("delivery-1"); d.Outcome != domain.WebhookOutcomeFailed || d.Error != "database is down" {
+		t.Errorf("Expected a failed delivery, got %+v", d)
+	}
+
+	f.builds.err = nil
+	if rec := f.push("delivery-1"); rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected the retry to be evaluated again, got %d", rec.Code)
+	}
+	if d := f.delivery("delivery-1"); d.Outcome != domain.WebhookOutcomeTriggered || d.Error != "" {
+		t.Errorf("Expected a triggered delivery, got %+v", d)
+	}
+	if len(f.deliveries.deliveries) != 1 || len(f.builds.created) != 1 {
+		t.Errorf("Expected one delivery and build, got %d and %d", len(f.deliveries.deliveries), len(f.builds.created))
+	}
+}
+
+func TestWebhookRetriesStalePendingDeliveries(t *testing.T) {
+	f := newWebhookFixture(t)
+
+	// Recorded, but the server died before evaluating it
+	d := &domain.WebhookDelivery{ProjectID: f.project.ID, DeliveryID: "delivery-1", Event: "Push Hook",
+		Payload: []byte(pushPayload), Outcome: domain.WebhookOutcomePending}
+	f.deliveries.Create(context.Background(), d)
+
+	if rec := f.push("delivery-1"); rec.Code != http.StatusOK || len(f.builds.created) != 0 {
+		t.Errorf("Expected a delivery being evaluated to be dropped, got %d and %d builds", rec.Code, len(f.builds.created))
+	}
+
+	f.deliveries.attempted[d.ID] = time.Now().Add(-2 * pendingDeliveryLease)
+	if rec := f.push("delivery-1"); rec.Code != http.StatusAccepted || len(f.builds.created) != 1 {
+		t.Errorf("Expected a stale delivery to be evaluated again, got %d and %d builds", rec.Code, len(f.builds.created))
+	}
+}
+
+func TestWebhookRedeliver(t *testing.T) {
+	f := newWebhookFixture(t)
+	f.push("delivery-1")
+	original := f.delivery("delivery-1")
+
+	req := httptest.NewRequest(http.MethodPost, "/projects/"+f.project.ID.String()+"/webhook-deliveries/"+original.ID.String()+"/redeliver", nil)
+	rec := httptest.NewRecorder()
+	f.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var got domain.WebhookDelivery
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID == original.ID || got.RedeliveryOf == nil || *got.RedeliveryOf != original.ID || got.DeliveryID != "" {
+		t.Errorf("Expected a new delivery pointing back at the original, got %+v", got)
+	}
+	if got.Outcome != domain.WebhookOutcomeTriggered || len(f.builds.created) != 2 || *got.BuildID != f.builds.created[1].ID {
+		t.Errorf("Expected the redelivery to trigger a second build, got %+v", got)
+	}
+
+	// Deliveries of other projects are not found
+	req = httptest.NewRequest(http.MethodPost, "/projects/"+uuid.NewString()+"/webhook-deliveries/"+original.ID.String()+"/redeliver", nil)
+	rec = httptest.NewRecorder()
+	f.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", rec.Code)
+	}
+}
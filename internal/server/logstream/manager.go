@@ -2,11 +2,15 @@ package logstream
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
-	"sync"
+	"regexp"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 )
@@ -15,20 +19,50 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
+// streamIDPattern matches Redis stream IDs, which double as log cursors.
+var streamIDPattern = regexp.MustCompile(`^\d+(-\d+)?$`)
+
+const (
+	readBatch    = 500
+	readTimeout  = 5 * time.Second
+	closeTimeout = time.Second
+)
+
+// Message is a single chunk of build output sent over the WebSocket. Seq is
+// the cursor a client passes back as ?since= to resume after a reconnect.
+// The last message of a finished build has End set and no data.
+type Message struct {
+	Seq  string `json:"seq"`
+	Data string `json:"data"`
+	End  bool   `json:"end,omitempty"`
+}
+
 type LogManager struct {
-	rdb         *redis.Client
-	subscribers map[string]map[*websocket.Conn]bool
-	mu          sync.RWMutex
+	rdb       *redis.Client
+	buildRepo domain.BuildRepository
 }
 
-func NewLogManager(rdb *redis.Client) *LogManager {
-	return &LogManager{
-		rdb:         rdb,
-		subscribers: make(map[string]map[*websocket.Conn]bool),
-	}
+func NewLogManager(rdb *redis.Client, br domain.BuildRepository) *LogManager {
+	return &LogManager{rdb: rdb, buildRepo: br}
 }
 
+// HandleWS replays everything in the build's log stream after ?since= (or
+// from the beginning) and then follows live output on the same cursor, so the
+// client sees every chunk exactly once. The worker ends the stream of a build
+// it finishes with a marker, after which the client is sent an End message
+// and the connection is closed. Builds finished elsewhere, such as pending
+// builds that were cancelled, or whose stream has expired, are noticed once
+// the stream has been idle for a read.
 func (m *LogManager) HandleWS(w http.ResponseWriter, r *http.Request, buildID string) {
+	since := r.URL.Query().Get("since")
+	if since == "" {
+		since = "0"
+	}
+	if !streamIDPattern.MatchString(since) {
+		http.Error(w, "invalid since cursor", http.StatusBadRequest)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		zap.L().Error("ws upgrade failed", zap.Error(err))
@@ -36,53 +70,82 @@ func (m *LogManager) HandleWS(w http.ResponseWriter, r *http.Request, buildID st
 	}
 	defer conn.Close()
 
-	m.mu.Lock()
-	if m.subscribers[buildID] == nil {
-		m.subscribers[buildID] = make(map[*websocket.Conn]bool)
-		// Start a redis subscriber for this build if it's the first client
-		go m.listenRedis(buildID)
-	}
-	m.subscribers[buildID][conn] = true
-	m.mu.Unlock()
-
-	defer func() {
-		m.mu.Lock()
-		delete(m.subscribers[buildID], conn)
-		if len(m.subscribers[buildID]) == 0 {
-			delete(m.subscribers, buildID)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Detect client disconnects
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
 		}
-		m.mu.Unlock()
 	}()
 
-	// Keep connection alive/wait for close
-	for {
-		if _, _, err := conn.ReadMessage(); err != nil {
-			break
+	stream := fmt.Sprintf("logs:%s", buildID)
+	cursor := since
+	block := readTimeout
+	for ctx.Err() == nil {
+		res, err := m.rdb.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{stream, cursor},
+			Count:   readBatch,
+			Block:   block,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			if block != readTimeout {
+				// Caught up with a build that had already finished
+				m.end(conn, cursor)
+				return
+			}
+			if m.finished(ctx, buildID) {
+				// Read once more for output written before it finished
+				block = time.Millisecond
+			}
+			continue
 		}
-	}
-}
-
-func (m *LogManager) listenRedis(buildID string) {
-	pubsub := m.rdb.Subscribe(context.Background(), fmt.Sprintf("logs:%s", buildID))
-	defer pubsub.Close()
-
-	ch := pubsub.Channel()
-	for msg := range ch {
-		m.mu.RLock()
-		conns := m.subscribers[buildID]
-		for conn := range conns {
-			if err := conn.WriteMessage(websocket.TextMessage, []byte(msg.Payload)); err != nil {
-				zap.L().Error("failed to write to ws", zap.Error(err))
+		if err != nil {
+			if ctx.Err() == nil {
+				zap.L().Error("failed to read log stream", zap.String("build_id", buildID), zap.Error(err))
 			}
+			return
 		}
-		m.mu.RUnlock()
 
-		// Stop listening if no more subscribers
-		m.mu.RLock()
-		_, exists := m.subscribers[buildID]
-		m.mu.RUnlock()
-		if !exists {
-			return
+		for _, s := range res {
+			for _, msg := range s.Messages {
+				if _, ok := msg.Values["end"]; ok {
+					m.end(conn, msg.ID)
+					return
+				}
+				data, _ := msg.Values["data"].(string)
+				if err := conn.WriteJSON(Message{Seq: msg.ID, Data: data}); err != nil {
+					return
+				}
+				cursor = msg.ID
+			}
 		}
 	}
 }
+
+// finished reports whether the build is known to have finished.
+func (m *LogManager) finished(ctx context.Context, buildID string) bool {
+	id, err := uuid.Parse(buildID)
+	if err != nil {
+		return false
+	}
+	build, err := m.buildRepo.GetByID(ctx, id)
+	if err != nil {
+		zap.L().Error("failed to get build", zap.String("build_id", buildID), zap.Error(err))
+		return false
+	}
+	return build == nil || build.Status.Finished()
+}
+
+// end tells the client the log is complete and closes the connection.
+func (m *LogManager) end(conn *websocket.Conn, seq string) {
+	if err := conn.WriteJSON(Message{Seq: seq, End: true}); err != nil {
+		return
+	}
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "build finished")
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeTimeout))
+}
@@ -0,0 +1,40 @@
+package status
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"go.uber.org/zap"
+)
+
+// Reporter publishes the status of a build to the commit it ran for, so
+// that pull requests show it as a check.
+type Reporter interface {
+	Report(ctx context.Context, build *domain.Build) error
+}
+
+// Update reports build's current status. Commit statuses are informational,
+// so a failure is logged rather than returned, and the report outlives a
+// cancelled ctx.
+func Update(ctx context.Context, r Reporter, build *domain.Build) {
+	if err := r.Report(context.WithoutCancel(ctx), build); err != nil {
+		zap.L().Warn("failed to report commit status", zap.String("build_id", build.ID.String()),
+			zap.String("status", string(build.Status)), zap.Error(err))
+	}
+}
+
+// Context names the check a build reports as: nanoci, or for a matrix
+// child nanoci/ followed by its combination, e.g. nanoci/GO=1.22,OS=linux.
+func Context(build *domain.Build) string {
+	if len(build.Matrix) == 0 {
+		return "nanoci"
+	}
+	pairs := make([]string, 0, len(build.Matrix))
+	for k, v := range build.Matrix {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return "nanoci/" + strings.Join(pairs, ",")
+}
@@ -0,0 +1,81 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"go.uber.org/zap"
+)
+
+// collectArtifacts stores the workspace files matching the pipeline's
+// artifact globs. Only regular files are collected; symlinks are not
+// followed, so a build cannot publish files from outside its workspace.
+func (e *Executor) collectArtifacts(ctx context.Context, build *domain.Build, pipeline *domain.Pipeline, workspace string, log io.Writer) {
+	if pipeline.Artifacts == nil {
+		return
+	}
+	expiresAt := time.Now().Add(pipeline.Artifacts.Expiry())
+
+	var count int
+	var total int64
+	err := filepath.WalkDir(workspace, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(workspace, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() && rel == ".git" {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() || !domain.MatchAny(pipeline.Artifacts.Paths, rel) {
+			return nil
+		}
+
+		a, err := e.storeArtifact(ctx, build, path, rel, expiresAt)
+		if err != nil {
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		count++
+		total += a.Size
+		return nil
+	})
+	if err != nil {
+		zap.L().Warn("failed to collect artifacts", zap.String("build_id", build.ID.String()), zap.Error(err))
+		fmt.Fprintf(log, "==> artifacts: failed to collect: %s\n", err)
+		return
+	}
+	fmt.Fprintf(log, "==> artifacts: stored %d files, %d bytes, until %s\n", count, total, expiresAt.UTC().Format(time.RFC3339))
+}
+
+func (e *Executor) storeArtifact(ctx context.Context, build *domain.Build, path, rel string, expiresAt time.Time) (*domain.Artifact, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	digest, size, err := e.artifacts.Put(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	a := &domain.Artifact{
+		BuildID:   build.ID,
+		Path:      rel,
+		Size:      size,
+		Digest:    digest,
+		ExpiresAt: expiresAt,
+	}
+	if err := e.artifactRepo.Create(ctx, a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
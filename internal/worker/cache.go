@@ -0,0 +1,57 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/princetheprogrammerbtw/nanoci/internal/cache"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"go.uber.org/zap"
+)
+
+// restoreCache renders the pipeline's cache key and restores the matching
+// entry into the workspace. It returns the key for saveCache, or "" if the
+// pipeline has no cache. Cache problems are reported but never fail a build.
+func (e *Executor) restoreCache(ctx context.Context, build *domain.Build, pipeline *domain.Pipeline, workspace string, log io.Writer) string {
+	if pipeline.Cache == nil {
+		return ""
+	}
+
+	key, err := cache.RenderKey(pipeline.Cache.Key, workspace, cache.KeyData{Branch: build.Branch})
+	if err != nil {
+		fmt.Fprintf(log, "==> cache: %s, caching disabled\n", err)
+		return ""
+	}
+
+	found, err := e.cache.Restore(ctx, build.ProjectID.String(), key, workspace)
+	switch {
+	case err != nil:
+		zap.L().Warn("failed to restore cache", zap.String("build_id", build.ID.String()), zap.String("key", key), zap.Error(err))
+		fmt.Fprintf(log, "==> cache: failed to restore %s: %s\n", key, err)
+	case found:
+		fmt.Fprintf(log, "==> cache: restored %s\n", key)
+	default:
+		fmt.Fprintf(log, "==> cache: no entry for %s\n", key)
+	}
+	return key
+}
+
+// saveCache stores the cache paths under key once the steps have succeeded.
+// Builds of forks only restore: whatever they saved would be restored into
+// trusted builds.
+func (e *Executor) saveCache(ctx context.Context, build *domain.Build, pipeline *domain.Pipeline, workspace, key string, log io.Writer) {
+	if key == "" {
+		return
+	}
+	if build.Fork {
+		fmt.Fprintf(log, "==> cache: not saving %s from a fork\n", key)
+		return
+	}
+	if err := e.cache.Save(ctx, build.ProjectID.String(), key, workspace, pipeline.Cache.Paths); err != nil {
+		zap.L().Warn("failed to save cache", zap.String("build_id", build.ID.String()), zap.String("key", key), zap.Error(err))
+		fmt.Fprintf(log, "==> cache: failed to save %s: %s\n", key, err)
+		return
+	}
+	fmt.Fprintf(log, "==> cache: saved %s\n", key)
+}
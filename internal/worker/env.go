@@ -0,0 +1,31 @@
+package worker
+
+import (
+	"strconv"
+
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+)
+
+// buildEnv returns the NANOCI_* variables that describe build to its steps.
+// Variables that do not apply, such as NANOCI_TAG outside tag builds, are
+// left unset.
+func buildEnv(build *domain.Build) map[string]string {
+	env := map[string]string{
+		"CI":              "true",
+		"NANOCI":          "true",
+		"NANOCI_BUILD_ID": build.ID.String(),
+		"NANOCI_COMMIT":   build.CommitHash,
+		"NANOCI_EVENT":    string(build.Event),
+	}
+	if build.Branch != "" {
+		env["NANOCI_BRANCH"] = build.Branch
+	}
+	if build.Tag != "" {
+		env["NANOCI_TAG"] = build.Tag
+	}
+	if build.PRNumber != nil {
+		env["NANOCI_PULL_REQUEST"] = strconv.Itoa(*build.PRNumber)
+		env["NANOCI_SOURCE_BRANCH"] = build.SourceBranch
+	}
+	return env
+}
@@ -0,0 +1,28 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+)
+
+func TestBuildEnv(t *testing.T) {
+	id := uuid.New()
+	tag := buildEnv(&domain.Build{ID: id, CommitHash: "abc123", Tag: "v1.0.0", Event: domain.BuildEventTag})
+	if tag["NANOCI_TAG"] != "v1.0.0" || tag["NANOCI_EVENT"] != "tag" || tag["NANOCI_BUILD_ID"] != id.String() {
+		t.Errorf("Unexpected tag build env: %v", tag)
+	}
+	if _, ok := tag["NANOCI_BRANCH"]; ok {
+		t.Errorf("Expected no NANOCI_BRANCH for a tag build, got %q", tag["NANOCI_BRANCH"])
+	}
+
+	number := 7
+	pr := buildEnv(&domain.Build{ID: id, Branch: "main", Event: domain.BuildEventPullRequest, PRNumber: &number, SourceBranch: "feature"})
+	if pr["NANOCI_PULL_REQUEST"] != "7" || pr["NANOCI_SOURCE_BRANCH"] != "feature" || pr["NANOCI_BRANCH"] != "main" {
+		t.Errorf("Unexpected pull request env: %v", pr)
+	}
+	if _, ok := pr["NANOCI_TAG"]; ok {
+		t.Error("Expected no NANOCI_TAG outside tag builds")
+	}
+}
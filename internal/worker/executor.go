@@ -2,43 +2,108 @@ package worker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/princetheprogrammerbtw/nanoci/internal/artifact"
+	"github.com/princetheprogrammerbtw/nanoci/internal/cache"
+	"github.com/princetheprogrammerbtw/nanoci/internal/checkout"
 	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"github.com/princetheprogrammerbtw/nanoci/internal/events"
+	"github.com/princetheprogrammerbtw/nanoci/internal/logstore"
+	"github.com/princetheprogrammerbtw/nanoci/internal/notify"
+	"github.com/princetheprogrammerbtw/nanoci/internal/queue"
 	"github.com/princetheprogrammerbtw/nanoci/internal/runner"
+	"github.com/princetheprogrammerbtw/nanoci/internal/status"
 	"github.com/princetheprogrammerbtw/nanoci/pkg/crypto"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
-	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrBuildCancelled is the cancellation cause of a build stopped by a user.
+	ErrBuildCancelled = errors.New("build cancelled")
+	// ErrBuildTimeout is the cancellation cause of a build that exceeded its pipeline timeout.
+	ErrBuildTimeout = errors.New("build timed out")
+	// ErrWorkerShutdown is the cancellation cause of builds cut off by the
+	// worker shutting down; they are requeued rather than finished.
+	ErrWorkerShutdown = errors.New("worker shutting down")
 )
 
 type Executor struct {
 	buildRepo     domain.BuildRepository
 	projectRepo   domain.ProjectRepository
 	secretRepo    domain.SecretRepository
+	stepRepo      domain.StepRepository
+	artifactRepo  domain.ArtifactRepository
+	queue         *queue.RedisQueue
+	events        events.Bus
 	runner        *runner.DockerRunner
 	rdb           *redis.Client
+	logs          logstore.Store
+	cache         cache.Store
+	artifacts     artifact.Store
+	notifier      *notify.Notifier
+	reporter      status.Reporter
 	encryptionKey []byte
+
+	mu      sync.Mutex
+	running map[string]context.CancelCauseFunc
 }
 
-func NewExecutor(br domain.BuildRepository, pr domain.ProjectRepository, sr domain.SecretRepository, r *runner.DockerRunner, rdb *redis.Client, key string) *Executor {
+func NewExecutor(br domain.BuildRepository, pr domain.ProjectRepository, sr domain.SecretRepository, str domain.StepRepository, ar domain.ArtifactRepository, q *queue.RedisQueue, bus events.Bus, r *runner.DockerRunner, rdb *redis.Client, logs logstore.Store, c cache.Store, as artifact.Store, n *notify.Notifier, rep status.Reporter, key string) *Executor {
 	return &Executor{
 		buildRepo:     br,
 		projectRepo:   pr,
 		secretRepo:    sr,
+		stepRepo:      str,
+		artifactRepo:  ar,
+		queue:         q,
+		events:        bus,
 		runner:        r,
 		rdb:           rdb,
+		logs:          logs,
+		cache:         c,
+		artifacts:     as,
+		notifier:      n,
+		reporter:      rep,
 		encryptionKey: []byte(key),
+		running:       make(map[string]context.CancelCauseFunc),
+	}
+}
+
+// Cancel stops buildID if it is running on this executor, reporting whether it was.
+func (e *Executor) Cancel(buildID string) bool {
+	e.mu.Lock()
+	cancel, ok := e.running[buildID]
+	e.mu.Unlock()
+	if ok {
+		cancel(ErrBuildCancelled)
 	}
+	return ok
 }
 
-func (e *Executor) Execute(ctx context.Context, buildID string) error {
+func (e *Executor) track(buildID string, cancel context.CancelCauseFunc) {
+	e.mu.Lock()
+	e.running[buildID] = cancel
+	e.mu.Unlock()
+}
+
+func (e *Executor) untrack(buildID string) {
+	e.mu.Lock()
+	delete(e.running, buildID)
+	e.mu.Unlock()
+}
+
+// Execute runs a build inside workspace, which must be an empty directory
+// owned by the caller. The workspace is emptied again before returning.
+func (e *Executor) Execute(ctx context.Context, buildID string, workspace string) error {
 	// ... (id parsing and build/project fetching)
 	id, err := uuid.Parse(buildID)
 	if err != nil {
@@ -52,23 +117,35 @@ func (e *Executor) Execute(ctx context.Context, buildID string) error {
 	if build == nil {
 		return fmt.Errorf("build not found: %s", buildID)
 	}
+	if build.Status == domain.BuildStatusCancelled {
+		zap.L().Info("skipping cancelled build", zap.String("build_id", buildID))
+		return nil
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	e.track(buildID, cancel)
+	defer e.untrack(buildID)
 
 	project, err := e.projectRepo.GetByID(ctx, build.ProjectID)
 	if err != nil {
 		return err
 	}
 
-	// Setup Log Writer
-	redisWriter := NewRedisLogWriter(ctx, e.rdb, buildID)
-	logWriter := io.MultiWriter(os.Stdout, redisWriter)
+	// Setup Log Writer; it outlives cancellation so the outcome still reaches clients
+	redisWriter := NewRedisLogWriter(context.WithoutCancel(ctx), e.rdb, buildID)
+	defer redisWriter.Close()
+	streamWriter := io.MultiWriter(os.Stdout, redisWriter)
 
 	// Fetch Secrets
 	// ...
 
-	// Fetch Secrets
-	secrets, err := e.secretRepo.ListByProjectID(ctx, project.ID)
-	if err != nil {
-		zap.L().Error("failed to fetch secrets", zap.Error(err))
+	// Fetch Secrets; code from a fork must not get to read them
+	var secrets []*domain.Secret
+	if !build.Fork {
+		if secrets, err = e.secretRepo.ListByProjectID(ctx, project.ID); err != nil {
+			zap.L().Error("failed to fetch secrets", zap.Error(err))
+		}
 	}
 
 	env := make(map[string]string)
@@ -80,80 +157,294 @@ func (e *Executor) Execute(ctx context.Context, buildID string) error {
 		}
 		env[s.Key] = val
 	}
+	for k, v := range buildEnv(build) {
+		env[k] = v
+	}
 
 	// Update build status to RUNNING
 	// ...
 
-	// Update build status to RUNNING
+	// Update build status to RUNNING, unless it was cancelled since it was read
 	now := time.Now()
 	build.Status = domain.BuildStatusRunning
 	build.StartedAt = &now
-	if err := e.buildRepo.Update(ctx, build); err != nil {
+	started, err := e.buildRepo.UpdateStatus(ctx, build, domain.BuildStatusPending)
+	if err != nil {
 		return err
 	}
+	if !started {
+		zap.L().Info("skipping build that is no longer pending", zap.String("build_id", buildID))
+		return nil
+	}
+	// A cancel message published before track is lost; the flag is not
+	if current, err := e.buildRepo.GetByID(ctx, id); err != nil {
+		zap.L().Error("failed to check for cancellation", zap.String("build_id", buildID), zap.Error(err))
+	} else if current != nil && current.CancelRequested {
+		cancel(ErrBuildCancelled)
+	}
+	e.emit(ctx, events.BuildStarted, build, nil)
+	status.Update(ctx, e.reporter, build)
 
-	// 1. Create Workspace
-	workspace, err := os.MkdirTemp("", "nanoci-*")
+	// Output outside of steps is persisted as the build's setup log, replacing
+	// the logs of an interrupted attempt
+	if err := e.logs.Delete(ctx, buildID); err != nil {
+		zap.L().Error("failed to reset logs", zap.String("build_id", buildID), zap.Error(err))
+	}
+	setupLog := logstore.NewWriter(context.WithoutCancel(ctx), e.logs, buildID, logstore.SetupLog)
+	defer setupLog.Close()
+	logWriter := io.MultiWriter(streamWriter, setupLog)
+	if build.Fork {
+		fmt.Fprintf(logWriter, "==> secrets: withheld from pull request from a fork\n")
+	}
+
+	// 1. Prepare Workspace
+	defer func() {
+		if err := cleanWorkspace(workspace); err != nil {
+			zap.L().Error("failed to clean workspace", zap.String("workspace", workspace), zap.Error(err))
+		}
+	}()
+
+	// 2. Checkout the pushed commit
+	creds, err := e.credentials(project)
 	if err != nil {
-		return err
+		return e.markFailed(ctx, build, err)
 	}
-	defer os.RemoveAll(workspace)
+	masks := creds.Secrets()
 
-	// 2. Clone Repo
-	zap.L().Info("cloning repository", zap.String("url", project.RepoURL), zap.String("commit", build.CommitHash))
-	cmd := exec.CommandContext(ctx, "git", "clone", "--depth", "1", project.RepoURL, workspace)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to clone repo: %w", err)
+	zap.L().Info("checking out repository", zap.String("url", project.RepoURL), zap.String("branch", build.Branch), zap.String("commit", build.CommitHash))
+	checkoutLog := NewMaskWriter(logWriter, masks)
+	err = checkout.Checkout(ctx, checkout.Options{
+		Dir:         workspace,
+		RepoURL:     project.RepoURL,
+		Ref:         build.Ref(),
+		Commit:      build.CommitHash,
+		Credentials: creds,
+		Output:      checkoutLog,
+	})
+	if err != nil {
+		fmt.Fprintf(checkoutLog, "\ncheckout failed: %s\n", err)
+		checkoutLog.Close()
+		return e.markFailed(ctx, build, fmt.Errorf("failed to checkout repo: %w", err))
 	}
+	checkoutLog.Close()
 
 	// 3. Parse .nanoci.yml
 	pipelineFile := filepath.Join(workspace, ".nanoci.yml")
 	data, err := os.ReadFile(pipelineFile)
 	if err != nil {
-		return fmt.Errorf("failed to read .nanoci.yml: %w", err)
+		return e.markFailed(ctx, build, fmt.Errorf("failed to read .nanoci.yml: %w", err))
 	}
 
-	var pipeline domain.Pipeline
-	if err := yaml.Unmarshal(data, &pipeline); err != nil {
-		return fmt.Errorf("failed to parse .nanoci.yml: %w", err)
+	pipeline, err := domain.ParsePipeline(data)
+	if err != nil {
+		return e.markFailed(ctx, build, fmt.Errorf("failed to parse .nanoci.yml: %w", err))
 	}
 
-	// 4. Run Steps
-	for _, step := range pipeline.Steps {
-		zap.L().Info("running step", zap.String("name", step.Name))
-		
-		// Merge project secrets into step env
-		mergedEnv := make(map[string]string)
-		for k, v := range env {
-			mergedEnv[k] = v
-		}
-		for k, v := range step.Env {
-			mergedEnv[k] = v
-		}
-		
-		step.Env = mergedEnv
+	// A matrix pipeline runs as one child build per combination
+	if pipeline.Matrix != nil && build.ParentID == nil {
+		return e.expandMatrix(ctx, build, pipeline.Matrix, logWriter)
+	}
+	if build.Matrix != nil {
+		fmt.Fprintf(logWriter, "==> matrix: %s\n", formatVars(build.Matrix))
+		pipeline.ApplyMatrix(build.Matrix)
+	}
+	deps, _ := pipeline.Dependencies()
 
-		exitCode, err := e.runner.RunStep(ctx, pipeline.Image, step, workspace, logWriter)
-		if err != nil {
-			return e.markFailed(ctx, build, err)
+	// The pipeline timeout counts from when the build started, clone included
+	if pipeline.Timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithDeadlineCause(ctx, now.Add(time.Duration(pipeline.Timeout)), ErrBuildTimeout)
+		defer cancelTimeout()
+	}
+
+	// 4. Record Steps, discarding any left over from an interrupted attempt
+	if err := e.stepRepo.DeleteByBuildID(ctx, build.ID); err != nil {
+		return e.markFailed(ctx, build, fmt.Errorf("failed to reset steps: %w", err))
+	}
+	stepRuns := make([]*domain.BuildStep, len(pipeline.Steps))
+	for i, step := range pipeline.Steps {
+		stepRuns[i] = &domain.BuildStep{
+			BuildID:  build.ID,
+			Name:     step.Name,
+			Position: i,
+			Status:   domain.StepStatusPending,
 		}
-		if exitCode != 0 {
-			return e.markFailed(ctx, build, fmt.Errorf("step %s failed with exit code %d", step.Name, exitCode))
+		if err := e.stepRepo.Create(ctx, stepRuns[i]); err != nil {
+			return e.markFailed(ctx, build, fmt.Errorf("failed to record step %s: %w", step.Name, err))
 		}
 	}
 
-	// 5. Success
+	// 5. Restore the dependency cache into the workspace
+	cacheKey := e.restoreCache(ctx, build, pipeline, workspace, logWriter)
+
+	// 6. Start Services; they are torn down however the build ends
+	images := e.runner.NewImagePuller()
+	services, err := e.runner.StartServices(ctx, buildID, pipeline.Services, images, logWriter)
+	if err != nil {
+		fmt.Fprintf(logWriter, "\n%s\n", err)
+		e.skipSteps(ctx, build, stepRuns)
+		return e.markFailed(ctx, build, err)
+	}
+	defer services.Stop()
+
+	// 7. Run Steps in dependency order, independent ones concurrently
+	run := &buildRun{
+		executor:  e,
+		build:     build,
+		pipeline:  pipeline,
+		workspace: workspace,
+		env:       env,
+		masks:     masks,
+		log:       logWriter,
+		stream:    streamWriter,
+		steps:     stepRuns,
+		images:    images,
+		services:  services,
+	}
+	stepsErr := run.runSteps(ctx, deps)
+
+	// 8. Keep artifacts, from failed builds too, unless the build was cancelled
+	if !cancelled(ctx) {
+		e.collectArtifacts(context.WithoutCancel(ctx), build, pipeline, workspace, logWriter)
+	}
+	if stepsErr != nil {
+		return e.markFailed(ctx, build, stepsErr)
+	}
+	e.saveCache(ctx, build, pipeline, workspace, cacheKey, logWriter)
+
+	// 9. Success
 	finishTime := time.Now()
 	build.Status = domain.BuildStatusSuccess
 	build.FinishedAt = &finishTime
-	return e.buildRepo.Update(ctx, build)
+	succeeded, err := e.buildRepo.UpdateStatus(ctx, build, domain.BuildStatusRunning)
+	if err != nil {
+		return err
+	}
+	if !succeeded {
+		zap.L().Info("build already finished elsewhere", zap.String("id", build.ID.String()))
+		return nil
+	}
+	e.finished(ctx, build)
+	e.finishParent(ctx, build)
+	return nil
 }
 
+// credentials decrypts the project's clone credentials, if it has any.
+func (e *Executor) credentials(project *domain.Project) (*checkout.Credentials, error) {
+	if project.CredentialType == domain.CredentialTypeNone {
+		return nil, nil
+	}
+
+	secret, err := crypto.Decrypt(project.EncryptedCredential, e.encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt project credentials: %w", err)
+	}
+
+	switch project.CredentialType {
+	case domain.CredentialTypeToken:
+		return &checkout.Credentials{Token: secret}, nil
+	case domain.CredentialTypeSSHKey:
+		return &checkout.Credentials{SSHKey: secret}, nil
+	default:
+		return nil, fmt.Errorf("unknown credential type: %s", project.CredentialType)
+	}
+}
+
+// markFailed finishes a build that did not succeed. Builds stopped through
+// Cancel are recorded as CANCELLED and builds that ran out of time as
+// TIMED_OUT rather than FAILED. Builds cut off by a worker shutdown are left
+// as they are for the caller to requeue.
 func (e *Executor) markFailed(ctx context.Context, build *domain.Build, err error) error {
-	zap.L().Error("build failed", zap.String("id", build.ID.String()), zap.Error(err))
+	if shuttingDown(ctx) {
+		zap.L().Info("build interrupted by worker shutdown", zap.String("id", build.ID.String()), zap.Error(err))
+		return ErrWorkerShutdown
+	}
 	finishTime := time.Now()
-	build.Status = domain.BuildStatusFailed
 	build.FinishedAt = &finishTime
-	_ = e.buildRepo.Update(ctx, build)
+	switch {
+	case cancelled(ctx):
+		zap.L().Info("build cancelled", zap.String("id", build.ID.String()))
+		build.Status = domain.BuildStatusCancelled
+		err = ErrBuildCancelled
+	case timedOut(ctx, err):
+		zap.L().Warn("build timed out", zap.String("id", build.ID.String()), zap.Error(err))
+		build.Status = domain.BuildStatusTimedOut
+	default:
+		zap.L().Error("build failed", zap.String("id", build.ID.String()), zap.Error(err))
+		build.Status = domain.BuildStatusFailed
+	}
+	// The build context may already be done; the final status must still land,
+	// unless the reaper finished the build in the meantime.
+	finished, updateErr := e.buildRepo.UpdateStatus(context.WithoutCancel(ctx), build, domain.BuildStatusRunning)
+	if updateErr != nil {
+		zap.L().Error("failed to record build result", zap.String("id", build.ID.String()), zap.Error(updateErr))
+		return err
+	}
+	if !finished {
+		zap.L().Info("build already finished elsewhere", zap.String("id", build.ID.String()))
+		return err
+	}
+	e.finished(ctx, build)
+	e.finishParent(ctx, build)
 	return err
 }
+
+func (e *Executor) finishStep(ctx context.Context, build *domain.Build, step *domain.BuildStep, status domain.StepStatus) {
+	finishTime := time.Now()
+	step.Status = status
+	step.FinishedAt = &finishTime
+	if err := e.stepRepo.Update(context.WithoutCancel(ctx), step); err != nil {
+		zap.L().Error("failed to update step", zap.String("name", step.Name), zap.Error(err))
+	}
+	e.emit(ctx, events.StepFinished, build, step)
+}
+
+// skipSteps marks steps that never ran, because their conditions did not
+// match or a step they depend on did not succeed.
+func (e *Executor) skipSteps(ctx context.Context, build *domain.Build, steps []*domain.BuildStep) {
+	for _, step := range steps {
+		step.Status = domain.StepStatusSkipped
+		if err := e.stepRepo.Update(context.WithoutCancel(ctx), step); err != nil {
+			zap.L().Error("failed to update step", zap.String("name", step.Name), zap.Error(err))
+		}
+		e.emit(ctx, events.StepFinished, build, step)
+	}
+}
+
+// finished announces a build that has reached its final status.
+func (e *Executor) finished(ctx context.Context, build *domain.Build) {
+	if err := EndLogStream(context.WithoutCancel(ctx), e.rdb, build.ID.String()); err != nil {
+		zap.L().Warn("failed to end log stream", zap.String("build_id", build.ID.String()), zap.Error(err))
+	}
+	e.emit(ctx, events.BuildFinished, build, nil)
+	status.Update(ctx, e.reporter, build)
+	e.notifier.Notify(ctx, build)
+}
+
+func (e *Executor) emit(ctx context.Context, t events.Type, build *domain.Build, step *domain.BuildStep) {
+	events.Emit(ctx, e.events, t, build, step)
+}
+
+func cancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrBuildCancelled)
+}
+
+func shuttingDown(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrWorkerShutdown)
+}
+
+func timedOut(ctx context.Context, err error) bool {
+	return errors.Is(context.Cause(ctx), ErrBuildTimeout) || errors.Is(err, runner.ErrStepTimeout)
+}
+
+// stepStatus is the outcome recorded for a step that did not succeed.
+func stepStatus(ctx context.Context, err error) domain.StepStatus {
+	switch {
+	case cancelled(ctx):
+		return domain.StepStatusCancelled
+	case timedOut(ctx, err):
+		return domain.StepStatusTimedOut
+	default:
+		return domain.StepStatusFailed
+	}
+}
@@ -0,0 +1,41 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+)
+
+func TestMarkFailedLeavesBuildsCutOffByShutdown(t *testing.T) {
+	build := &domain.Build{ID: uuid.New(), Status: domain.BuildStatusRunning}
+	repo := &fakeBuildRepo{builds: map[uuid.UUID]*domain.Build{build.ID: build}}
+	e := &Executor{buildRepo: repo}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(ErrWorkerShutdown)
+	err := e.markFailed(ctx, build, context.Canceled)
+	if !errors.Is(err, ErrWorkerShutdown) {
+		t.Errorf("Expected ErrWorkerShutdown, got %v", err)
+	}
+	if got, _ := repo.GetByID(context.Background(), build.ID); got.Status != domain.BuildStatusRunning || repo.updates != 0 {
+		t.Errorf("Expected build to stay RUNNING for requeueing, got %s after %d updates", got.Status, repo.updates)
+	}
+}
+
+func TestMarkFailedLeavesBuildsFinishedElsewhere(t *testing.T) {
+	// The reaper gave up on this worker and cancelled the build
+	build := &domain.Build{ID: uuid.New(), Status: domain.BuildStatusCancelled}
+	repo := &fakeBuildRepo{builds: map[uuid.UUID]*domain.Build{build.ID: build}}
+	// Without a log stream, bus or notifier, reporting the result would panic
+	e := &Executor{buildRepo: repo}
+
+	running := *build
+	running.Status = domain.BuildStatusRunning
+	e.markFailed(context.Background(), &running, errors.New("step test failed"))
+	if got, _ := repo.GetByID(context.Background(), build.ID); got.Status != domain.BuildStatusCancelled || repo.updates != 0 {
+		t.Errorf("Expected build to stay CANCELLED, got %s after %d updates", got.Status, repo.updates)
+	}
+}
@@ -3,10 +3,20 @@ package worker
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+const (
+	// logStreamMaxLen caps the live stream; older lines remain in the log store.
+	logStreamMaxLen = 100000
+	// logStreamTTL is how long a finished build's stream stays replayable.
+	logStreamTTL = 24 * time.Hour
+)
+
+// RedisLogWriter appends build output to the Redis stream logs:<buildID> so
+// that late subscribers can replay it before following live output.
 type RedisLogWriter struct {
 	rdb     *redis.Client
 	ctx     context.Context
@@ -22,9 +32,43 @@ func NewRedisLogWriter(ctx context.Context, rdb *redis.Client, buildID string) *
 }
 
 func (w *RedisLogWriter) Write(p []byte) (n int, err error) {
-	channel := fmt.Sprintf("logs:%s", w.buildID)
-	if err := w.rdb.Publish(w.ctx, channel, string(p)).Err(); err != nil {
+	err = w.rdb.XAdd(w.ctx, &redis.XAddArgs{
+		Stream: w.stream(),
+		MaxLen: logStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"data": string(p)},
+	}).Err()
+	if err != nil {
 		return 0, err
 	}
 	return len(p), nil
 }
+
+// Close schedules the stream for expiry once the build is done writing to it.
+func (w *RedisLogWriter) Close() error {
+	return w.rdb.Expire(context.Background(), w.stream(), logStreamTTL).Err()
+}
+
+func (w *RedisLogWriter) stream() string {
+	return logStream(w.buildID)
+}
+
+// EndLogStream appends the end-of-log marker to the stream of a build that
+// has finished, telling followers that no more output will come.
+func EndLogStream(ctx context.Context, rdb *redis.Client, buildID string) error {
+	stream := logStream(buildID)
+	err := rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		MaxLen: logStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"end": "1"},
+	}).Err()
+	if err != nil {
+		return err
+	}
+	return rdb.Expire(ctx, stream, logStreamTTL).Err()
+}
+
+func logStream(buildID string) string {
+	return fmt.Sprintf("logs:%s", buildID)
+}
@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+const maskReplacement = "***"
+
+// MaskWriter replaces secret values with *** before they reach w. A secret
+// split across two writes is still caught: any trailing bytes that could be
+// the start of a secret are held back until the next Write or Close.
+type MaskWriter struct {
+	w       io.Writer
+	secrets [][]byte
+
+	mu      sync.Mutex
+	pending []byte
+}
+
+func NewMaskWriter(w io.Writer, secrets []string) *MaskWriter {
+	m := &MaskWriter{w: w}
+	for _, s := range secrets {
+		if s != "" {
+			m.secrets = append(m.secrets, []byte(s))
+		}
+	}
+	return m
+}
+
+func (m *MaskWriter) Write(p []byte) (int, error) {
+	if len(m.secrets) == 0 {
+		return m.w.Write(p)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	buf := m.mask(append(m.pending, p...))
+	hold := m.partialSecretSuffix(buf)
+	m.pending = append([]byte(nil), buf[len(buf)-hold:]...)
+
+	if _, err := m.w.Write(buf[:len(buf)-hold]); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close flushes any held back bytes.
+func (m *MaskWriter) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.pending) == 0 {
+		return nil
+	}
+	_, err := m.w.Write(m.pending)
+	m.pending = nil
+	return err
+}
+
+func (m *MaskWriter) mask(b []byte) []byte {
+	for _, s := range m.secrets {
+		b = bytes.ReplaceAll(b, s, []byte(maskReplacement))
+	}
+	return b
+}
+
+// partialSecretSuffix returns the length of the longest suffix of b that is a
+// proper prefix of some secret.
+func (m *MaskWriter) partialSecretSuffix(b []byte) int {
+	longest := 0
+	for _, s := range m.secrets {
+		for n := len(s) - 1; n > longest; n-- {
+			if n <= len(b) && bytes.HasSuffix(b, s[:n]) {
+				longest = n
+				break
+			}
+		}
+	}
+	return longest
+}
@@ -0,0 +1,37 @@
+package worker
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMaskWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   string
+	}{
+		{"single write", []string{"token=hunter2secret ok\n"}, "token=*** ok\n"},
+		{"split across writes", []string{"token=hunter", "2sec", "ret ok\n"}, "token=*** ok\n"},
+		{"prefix only", []string{"hunter2 is not it\n"}, "hunter2 is not it\n"},
+		{"trailing prefix flushed on close", []string{"end hunt"}, "end hunt"},
+		{"repeated", []string{"hunter2secrethunter2secret"}, "******"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			m := NewMaskWriter(&out, []string{"hunter2secret"})
+			for _, c := range tt.chunks {
+				if _, err := m.Write([]byte(c)); err != nil {
+					t.Fatalf("Write failed: %v", err)
+				}
+			}
+			m.Close()
+
+			if out.String() != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, out.String())
+			}
+		})
+	}
+}
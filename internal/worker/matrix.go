@@ -0,0 +1,106 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"github.com/princetheprogrammerbtw/nanoci/internal/events"
+	"github.com/princetheprogrammerbtw/nanoci/internal/queue"
+	"github.com/princetheprogrammerbtw/nanoci/internal/status"
+	"go.uber.org/zap"
+)
+
+// expandMatrix queues one child build per matrix combination. The parent
+// stays RUNNING until the last child finishes, see domain.FinishParent.
+// Children that already exist, because an earlier attempt at the parent was
+// interrupted, are not queued again.
+func (e *Executor) expandMatrix(ctx context.Context, parent *domain.Build, matrix *domain.Matrix, log io.Writer) error {
+	combos := matrix.Combinations()
+	if len(combos) == 0 {
+		return e.markFailed(ctx, parent, fmt.Errorf("matrix has no combinations"))
+	}
+
+	existing, err := e.buildRepo.ListByParentID(ctx, parent.ID)
+	if err != nil {
+		return e.markFailed(ctx, parent, fmt.Errorf("failed to list matrix builds: %w", err))
+	}
+
+	for _, vars := range combos {
+		if hasChild(existing, vars) {
+			continue
+		}
+		child := &domain.Build{
+			ProjectID:     parent.ProjectID,
+			CommitHash:    parent.CommitHash,
+			CommitMessage: parent.CommitMessage,
+			Branch:        parent.Branch,
+			Tag:           parent.Tag,
+			Event:         parent.Event,
+			ChangedFiles:  parent.ChangedFiles,
+			PRNumber:      parent.PRNumber,
+			SourceBranch:  parent.SourceBranch,
+			CheckoutRef:   parent.CheckoutRef,
+			Fork:          parent.Fork,
+			ParentID:      &parent.ID,
+			Matrix:        vars,
+			Status:        domain.BuildStatusPending,
+		}
+		if err := e.buildRepo.Create(ctx, child); err != nil {
+			return e.markFailed(ctx, parent, fmt.Errorf("failed to create matrix build: %w", err))
+		}
+		if err := e.queue.Enqueue(ctx, &queue.Job{BuildID: child.ID.String()}); err != nil {
+			return e.markFailed(ctx, parent, fmt.Errorf("failed to queue matrix build: %w", err))
+		}
+		e.emit(ctx, events.BuildQueued, child, nil)
+		status.Update(ctx, e.reporter, child)
+		fmt.Fprintf(log, "==> matrix: queued build %s with %s\n", child.ID, formatVars(vars))
+	}
+
+	zap.L().Info("expanded matrix build", zap.String("build_id", parent.ID.String()), zap.Int("builds", len(combos)))
+	return nil
+}
+
+// finishParent rolls a finished matrix child up into its parent.
+func (e *Executor) finishParent(ctx context.Context, child *domain.Build) {
+	parent, err := domain.FinishParent(context.WithoutCancel(ctx), e.buildRepo, child)
+	if err != nil {
+		zap.L().Error("failed to update matrix parent", zap.String("build_id", child.ID.String()), zap.Error(err))
+		return
+	}
+	if parent != nil {
+		e.finished(ctx, parent)
+	}
+}
+
+func hasChild(children []*domain.Build, vars map[string]string) bool {
+	for _, c := range children {
+		if len(c.Matrix) != len(vars) {
+			continue
+		}
+		same := true
+		for k, v := range vars {
+			if c.Matrix[k] != v {
+				same = false
+				break
+			}
+		}
+		if same {
+			return true
+		}
+	}
+	return false
+}
+
+// formatVars renders vars as sorted KEY=value pairs.
+func formatVars(vars map[string]string) string {
+	pairs := make([]string, 0, len(vars))
+	for k, v := range vars {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
@@ -0,0 +1,109 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Slot is one unit of worker concurrency. Each slot owns a workspace
+// directory that is reused, and emptied, between the builds it runs.
+type Slot struct {
+	ID        int
+	Workspace string
+}
+
+// Pool bounds the number of builds a worker runs at once.
+type Pool struct {
+	slots chan *Slot
+	all   []*Slot
+	wg    sync.WaitGroup
+}
+
+func NewPool(size int) (*Pool, error) {
+	if size < 1 {
+		size = 1
+	}
+
+	p := &Pool{slots: make(chan *Slot, size)}
+	for i := 0; i < size; i++ {
+		dir, err := os.MkdirTemp("", fmt.Sprintf("nanoci-slot%d-*", i))
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		s := &Slot{ID: i, Workspace: dir}
+		p.all = append(p.all, s)
+		p.slots <- s
+	}
+	return p, nil
+}
+
+// Acquire waits for a free slot. It returns false if ctx is done first.
+func (p *Pool) Acquire(ctx context.Context) (*Slot, bool) {
+	select {
+	case s := <-p.slots:
+		return s, true
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+func (p *Pool) Release(s *Slot) {
+	p.slots <- s
+}
+
+// Go runs fn on the acquired slot and releases it when fn returns.
+func (p *Pool) Go(s *Slot, fn func(s *Slot)) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer p.Release(s)
+		fn(s)
+	}()
+}
+
+// Wait blocks until every running build has returned or timeout elapses,
+// reporting whether the pool drained in time.
+func (p *Pool) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Close removes the slot workspaces.
+func (p *Pool) Close() error {
+	var firstErr error
+	for _, s := range p.all {
+		if err := os.RemoveAll(s.Workspace); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// cleanWorkspace empties dir without removing it.
+func cleanWorkspace(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
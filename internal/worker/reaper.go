@@ -0,0 +1,224 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"github.com/princetheprogrammerbtw/nanoci/internal/events"
+	"github.com/princetheprogrammerbtw/nanoci/internal/logstore"
+	"github.com/princetheprogrammerbtw/nanoci/internal/queue"
+	"github.com/princetheprogrammerbtw/nanoci/internal/status"
+	"go.uber.org/zap"
+)
+
+// reaperQueue is the part of the job queue the reaper works with.
+type reaperQueue interface {
+	ExpiredWorkers(ctx context.Context) ([]string, error)
+	Claim(ctx context.Context, deadWorkerID, workerID string) (*queue.Delivery, error)
+	Forget(ctx context.Context, workerID string) error
+	Ack(ctx context.Context, d *queue.Delivery) error
+	Nack(ctx context.Context, d *queue.Delivery) error
+}
+
+// buildNotifier sends the results of finished builds to their project's
+// notification targets.
+type buildNotifier interface {
+	Notify(ctx context.Context, build *domain.Build)
+}
+
+// Reaper recovers jobs held by workers whose heartbeat has expired. Jobs are
+// requeued until they have been delivered maxAttempts times, after which the
+// build is marked FAILED. Builds that were asked to cancel are marked
+// CANCELLED instead of being run again. Jobs of builds that already
+// finished, because the worker died between recording the result and
+// acknowledging the job, are simply dropped.
+type Reaper struct {
+	queue       reaperQueue
+	buildRepo   domain.BuildRepository
+	stepRepo    domain.StepRepository
+	logs        logstore.Store
+	events      events.Bus
+	reporter    status.Reporter
+	notifier    buildNotifier
+	workerID    string
+	maxAttempts int
+}
+
+func NewReaper(q reaperQueue, br domain.BuildRepository, sr domain.StepRepository, logs logstore.Store, bus events.Bus, rep status.Reporter, n buildNotifier, workerID string, maxAttempts int) *Reaper {
+	return &Reaper{
+		queue:       q,
+		buildRepo:   br,
+		stepRepo:    sr,
+		logs:        logs,
+		events:      bus,
+		reporter:    rep,
+		notifier:    n,
+		workerID:    workerID,
+		maxAttempts: maxAttempts,
+	}
+}
+
+func (r *Reaper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Reap(ctx); err != nil {
+				zap.L().Error("failed to reap jobs", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (r *Reaper) Reap(ctx context.Context) error {
+	dead, err := r.queue.ExpiredWorkers(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, deadWorker := range dead {
+		for {
+			d, err := r.queue.Claim(ctx, deadWorker, r.workerID)
+			if err != nil && d == nil {
+				return err
+			}
+			if d == nil {
+				break
+			}
+			r.recover(ctx, deadWorker, d)
+		}
+
+		if err := r.queue.Forget(ctx, deadWorker); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Reaper) recover(ctx context.Context, deadWorker string, d *queue.Delivery) {
+	log := zap.L().With(zap.String("build_id", d.Job.BuildID), zap.String("dead_worker", deadWorker))
+
+	id, err := uuid.Parse(d.Job.BuildID)
+	if err != nil {
+		log.Error("dropping unrecoverable job", zap.Error(err))
+		_ = r.queue.Ack(ctx, d)
+		return
+	}
+
+	build, err := r.buildRepo.GetByID(ctx, id)
+	if err != nil || build == nil {
+		log.Error("dropping job for unknown build", zap.Error(err))
+		_ = r.queue.Ack(ctx, d)
+		return
+	}
+	if build.Status.Finished() {
+		log.Info("dropping job for finished build", zap.String("status", string(build.Status)))
+		_ = r.queue.Ack(ctx, d)
+		return
+	}
+
+	if build.CancelRequested {
+		log.Info("cancelling build after worker loss")
+		if err := r.finish(ctx, build, domain.BuildStatusCancelled, d); err != nil {
+			log.Error("failed to update build", zap.Error(err))
+		}
+		return
+	}
+
+	if d.Job.Attempts+1 >= r.maxAttempts {
+		log.Warn("giving up on build after worker loss", zap.Int("attempts", d.Job.Attempts+1))
+		if err := r.finish(ctx, build, domain.BuildStatusFailed, d); err != nil {
+			log.Error("failed to update build", zap.Error(err))
+		}
+		return
+	}
+
+	log.Info("requeueing build after worker loss", zap.Int("attempts", d.Job.Attempts+1))
+	if err := r.requeue(ctx, build, d); err != nil {
+		log.Error("failed to requeue job", zap.Error(err))
+	}
+}
+
+// finish records status as the final status of build, rolls it up into its
+// matrix parent and acknowledges its job.
+func (r *Reaper) finish(ctx context.Context, build *domain.Build, status domain.BuildStatus, d *queue.Delivery) error {
+	finishTime := time.Now()
+	build.Status = status
+	build.FinishedAt = &finishTime
+	if err := r.buildRepo.Update(ctx, build); err != nil {
+		return err
+	}
+	r.finished(ctx, build)
+	parent, err := domain.FinishParent(ctx, r.buildRepo, build)
+	if err != nil {
+		zap.L().Error("failed to update matrix parent", zap.String("build_id", build.ID.String()), zap.Error(err))
+	} else if parent != nil {
+		r.finished(ctx, parent)
+	}
+	return r.queue.Ack(ctx, d)
+}
+
+func (r *Reaper) finished(ctx context.Context, build *domain.Build) {
+	events.Emit(ctx, r.events, events.BuildFinished, build, nil)
+	status.Update(ctx, r.reporter, build)
+	r.notifier.Notify(ctx, build)
+}
+
+// Requeue resets a build that was interrupted before finishing, such as by
+// the worker shutting down, and its steps back to PENDING and puts its job
+// back on the queue. The job of a build that did
+// finish is acknowledged instead, and a build that was asked to cancel is
+// marked CANCELLED.
+func (r *Reaper) Requeue(ctx context.Context, d *queue.Delivery) error {
+	id, err := uuid.Parse(d.Job.BuildID)
+	if err != nil {
+		return err
+	}
+	build, err := r.buildRepo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if build == nil || build.Status.Finished() {
+		return r.queue.Ack(ctx, d)
+	}
+	if build.CancelRequested {
+		return r.finish(ctx, build, domain.BuildStatusCancelled, d)
+	}
+	return r.requeue(ctx, build, d)
+}
+
+func (r *Reaper) requeue(ctx context.Context, build *domain.Build, d *queue.Delivery) error {
+	build.Status = domain.BuildStatusPending
+	build.StartedAt = nil
+	build.FinishedAt = nil
+	if err := r.buildRepo.Update(ctx, build); err != nil {
+		return err
+	}
+	steps, err := r.stepRepo.ListByBuildID(ctx, build.ID)
+	if err != nil {
+		return err
+	}
+	for _, step := range steps {
+		step.Status = domain.StepStatusPending
+		step.ExitCode = nil
+		step.StartedAt = nil
+		step.FinishedAt = nil
+		if err := r.stepRepo.Update(ctx, step); err != nil {
+			return err
+		}
+	}
+	if err := r.logs.Delete(ctx, build.ID.String()); err != nil {
+		return err
+	}
+	if err := r.queue.Nack(ctx, d); err != nil {
+		return err
+	}
+	events.Emit(ctx, r.events, events.BuildQueued, build, nil)
+	return nil
+}
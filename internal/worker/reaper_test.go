@@ -0,0 +1,287 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"github.com/princetheprogrammerbtw/nanoci/internal/events"
+	"github.com/princetheprogrammerbtw/nanoci/internal/logstore"
+	"github.com/princetheprogrammerbtw/nanoci/internal/queue"
+)
+
+// fakeLogStore records which builds had their logs deleted.
+type fakeLogStore struct {
+	logstore.Store
+	deleted []string
+}
+
+func (s *fakeLogStore) Delete(ctx context.Context, buildID string) error {
+	s.deleted = append(s.deleted, buildID)
+	return nil
+}
+
+// fakeQueue holds the jobs of dead workers in memory and records what the
+// reaper did with each.
+type fakeQueue struct {
+	held   map[string][]*queue.Delivery
+	acked  []*queue.Delivery
+	nacked []*queue.Delivery
+}
+
+func (q *fakeQueue) ExpiredWorkers(ctx context.Context) ([]string, error) {
+	var dead []string
+	for w := range q.held {
+		dead = append(dead, w)
+	}
+	return dead, nil
+}
+
+func (q *fakeQueue) Claim(ctx context.Context, deadWorkerID, workerID string) (*queue.Delivery, error) {
+	held := q.held[deadWorkerID]
+	if len(held) == 0 {
+		return nil, nil
+	}
+	d := held[0]
+	q.held[deadWorkerID] = held[1:]
+	d.WorkerID = workerID
+	return d, nil
+}
+
+func (q *fakeQueue) Forget(ctx context.Context, workerID string) error {
+	delete(q.held, workerID)
+	return nil
+}
+
+func (q *fakeQueue) Ack(ctx context.Context, d *queue.Delivery) error {
+	q.acked = append(q.acked, d)
+	return nil
+}
+
+func (q *fakeQueue) Nack(ctx context.Context, d *queue.Delivery) error {
+	q.nacked = append(q.nacked, d)
+	return nil
+}
+
+type fakeBuildRepo struct {
+	domain.BuildRepository
+	mu      sync.Mutex
+	builds  map[uuid.UUID]*domain.Build
+	updates int
+}
+
+func (r *fakeBuildRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Build, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.builds[id]
+	if !ok {
+		return nil, nil
+	}
+	c := *b
+	return &c, nil
+}
+
+func (r *fakeBuildRepo) Update(ctx context.Context, build *domain.Build) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := *build
+	r.builds[build.ID] = &c
+	r.updates++
+	return nil
+}
+
+func (r *fakeBuildRepo) UpdateStatus(ctx context.Context, build *domain.Build, from domain.BuildStatus) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if b, ok := r.builds[build.ID]; !ok || b.Status != from {
+		return false, nil
+	}
+	c := *build
+	r.builds[build.ID] = &c
+	r.updates++
+	return true, nil
+}
+
+type fakeStepRepo struct {
+	domain.StepRepository
+	steps []*domain.BuildStep
+}
+
+func (r *fakeStepRepo) ListByBuildID(ctx context.Context, buildID uuid.UUID) ([]*domain.BuildStep, error) {
+	var steps []*domain.BuildStep
+	for _, s := range r.steps {
+		if s.BuildID == buildID {
+			c := *s
+			steps = append(steps, &c)
+		}
+	}
+	return steps, nil
+}
+
+func (r *fakeStepRepo) Update(ctx context.Context, step *domain.BuildStep) error {
+	for i, s := range r.steps {
+		if s.ID == step.ID {
+			c := *step
+			r.steps[i] = &c
+		}
+	}
+	return nil
+}
+
+type fakeBus struct {
+	events.Bus
+	published []events.Type
+}
+
+func (b *fakeBus) Publish(ctx context.Context, e *events.Event) error {
+	b.published = append(b.published, e.Type)
+	return nil
+}
+
+type fakeReporter struct {
+	reported []domain.BuildStatus
+}
+
+func (r *fakeReporter) Report(ctx context.Context, build *domain.Build) error {
+	r.reported = append(r.reported, build.Status)
+	return nil
+}
+
+type fakeNotifier struct {
+	notified []domain.BuildStatus
+}
+
+func (n *fakeNotifier) Notify(ctx context.Context, build *domain.Build) {
+	n.notified = append(n.notified, build.Status)
+}
+
+func TestReaperDropsJobsOfFinishedBuilds(t *testing.T) {
+	for _, s := range []domain.BuildStatus{domain.BuildStatusSuccess, domain.BuildStatusFailed, domain.BuildStatusTimedOut, domain.BuildStatusCancelled} {
+		t.Run(string(s), func(t *testing.T) {
+			build := &domain.Build{ID: uuid.New(), Status: s}
+			repo := &fakeBuildRepo{builds: map[uuid.UUID]*domain.Build{build.ID: build}}
+			d := &queue.Delivery{Job: &queue.Job{BuildID: build.ID.String()}}
+			q := &fakeQueue{held: map[string][]*queue.Delivery{"dead": {d}}}
+			bus, rep, n := &fakeBus{}, &fakeReporter{}, &fakeNotifier{}
+
+			r := NewReaper(q, repo, &fakeStepRepo{}, &fakeLogStore{}, bus, rep, n, "reaper", 3)
+			if err := r.Reap(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(q.acked) != 1 || len(q.nacked) != 0 {
+				t.Errorf("Expected the job to be acked only, got %d acks and %d nacks", len(q.acked), len(q.nacked))
+			}
+			if got, _ := repo.GetByID(context.Background(), build.ID); got.Status != s || repo.updates != 0 {
+				t.Errorf("Expected build to stay %s untouched, got %s after %d updates", s, got.Status, repo.updates)
+			}
+			if len(bus.published) != 0 || len(rep.reported) != 0 || len(n.notified) != 0 {
+				t.Errorf("Expected no events, statuses or notifications, got %v, %v and %v", bus.published, rep.reported, n.notified)
+			}
+
+			// The same holds for jobs requeued on shutdown
+			if err := r.Requeue(context.Background(), d); err != nil || len(q.nacked) != 0 {
+				t.Errorf("Expected Requeue to ack the job, got %d nacks (%v)", len(q.nacked), err)
+			}
+		})
+	}
+}
+
+func TestReaperRequeuesRunningBuilds(t *testing.T) {
+	build := &domain.Build{ID: uuid.New(), Status: domain.BuildStatusRunning}
+	repo := &fakeBuildRepo{builds: map[uuid.UUID]*domain.Build{build.ID: build}}
+	q := &fakeQueue{held: map[string][]*queue.Delivery{"dead": {{Job: &queue.Job{BuildID: build.ID.String()}}}}}
+
+	r := NewReaper(q, repo, &fakeStepRepo{}, &fakeLogStore{}, &fakeBus{}, &fakeReporter{}, &fakeNotifier{}, "reaper", 3)
+	if err := r.Reap(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(q.nacked) != 1 {
+		t.Fatalf("Expected the job to be requeued, got %d nacks", len(q.nacked))
+	}
+	if got, _ := repo.GetByID(context.Background(), build.ID); got.Status != domain.BuildStatusPending {
+		t.Errorf("Expected build to be PENDING again, got %s", got.Status)
+	}
+}
+
+func TestReaperCancelsBuildsAskedToCancel(t *testing.T) {
+	build := &domain.Build{ID: uuid.New(), Status: domain.BuildStatusRunning, CancelRequested: true}
+	repo := &fakeBuildRepo{builds: map[uuid.UUID]*domain.Build{build.ID: build}}
+	q := &fakeQueue{held: map[string][]*queue.Delivery{"dead": {{Job: &queue.Job{BuildID: build.ID.String()}}}}}
+	bus, rep, n := &fakeBus{}, &fakeReporter{}, &fakeNotifier{}
+
+	r := NewReaper(q, repo, &fakeStepRepo{}, &fakeLogStore{}, bus, rep, n, "reaper", 3)
+	if err := r.Reap(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(q.acked) != 1 || len(q.nacked) != 0 {
+		t.Errorf("Expected the job to be acked only, got %d acks and %d nacks", len(q.acked), len(q.nacked))
+	}
+	if got, _ := repo.GetByID(context.Background(), build.ID); got.Status != domain.BuildStatusCancelled || got.FinishedAt == nil {
+		t.Errorf("Expected build to be CANCELLED, got %s", got.Status)
+	}
+	if len(rep.reported) != 1 || rep.reported[0] != domain.BuildStatusCancelled {
+		t.Errorf("Expected a CANCELLED status report, got %v", rep.reported)
+	}
+	if len(n.notified) != 1 || n.notified[0] != domain.BuildStatusCancelled {
+		t.Errorf("Expected a CANCELLED notification, got %v", n.notified)
+	}
+}
+
+func TestReaperFailsBuildsOutOfAttempts(t *testing.T) {
+	build := &domain.Build{ID: uuid.New(), Status: domain.BuildStatusRunning}
+	repo := &fakeBuildRepo{builds: map[uuid.UUID]*domain.Build{build.ID: build}}
+	q := &fakeQueue{held: map[string][]*queue.Delivery{"dead": {{Job: &queue.Job{BuildID: build.ID.String(), Attempts: 2}}}}}
+	rep, n := &fakeReporter{}, &fakeNotifier{}
+
+	r := NewReaper(q, repo, &fakeStepRepo{}, &fakeLogStore{}, &fakeBus{}, rep, n, "reaper", 3)
+	if err := r.Reap(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(q.acked) != 1 || len(q.nacked) != 0 {
+		t.Errorf("Expected the job to be acked only, got %d acks and %d nacks", len(q.acked), len(q.nacked))
+	}
+	if got, _ := repo.GetByID(context.Background(), build.ID); got.Status != domain.BuildStatusFailed {
+		t.Errorf("Expected build to be FAILED, got %s", got.Status)
+	}
+	if len(n.notified) != 1 || n.notified[0] != domain.BuildStatusFailed {
+		t.Errorf("Expected a FAILED notification, got %v", n.notified)
+	}
+}
+
+func TestReaperRequeuesBuildsInterruptedByShutdown(t *testing.T) {
+	started := time.Now()
+	exitCode := 137
+	build := &domain.Build{ID: uuid.New(), Status: domain.BuildStatusRunning, StartedAt: &started}
+	repo := &fakeBuildRepo{builds: map[uuid.UUID]*domain.Build{build.ID: build}}
+	steps := &fakeStepRepo{steps: []*domain.BuildStep{
+		{ID: uuid.New(), BuildID: build.ID, Name: "test", Status: domain.StepStatusFailed, ExitCode: &exitCode, StartedAt: &started, FinishedAt: &started},
+	}}
+	logs := &fakeLogStore{}
+	q := &fakeQueue{}
+	bus, n := &fakeBus{}, &fakeNotifier{}
+
+	r := NewReaper(q, repo, steps, logs, bus, &fakeReporter{}, n, "worker", 3)
+	d := &queue.Delivery{Job: &queue.Job{BuildID: build.ID.String()}}
+	if err := r.Requeue(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	if len(q.nacked) != 1 || len(q.acked) != 0 {
+		t.Errorf("Expected the job to be requeued, got %d acks and %d nacks", len(q.acked), len(q.nacked))
+	}
+	if got, _ := repo.GetByID(context.Background(), build.ID); got.Status != domain.BuildStatusPending || got.StartedAt != nil {
+		t.Errorf("Expected build to be PENDING again, got %s", got.Status)
+	}
+	if s := steps.steps[0]; s.Status != domain.StepStatusPending || s.ExitCode != nil || s.StartedAt != nil || s.FinishedAt != nil {
+		t.Errorf("Expected step to be reset to PENDING, got %+v", s)
+	}
+	if len(logs.deleted) != 1 || logs.deleted[0] != build.ID.String() {
+		t.Errorf("Expected the build's logs to be deleted, got %v", logs.deleted)
+	}
+	if len(bus.published) != 1 || bus.published[0] != events.BuildQueued || len(n.notified) != 0 {
+		t.Errorf("Expected only a build.queued event, got %v and notifications %v", bus.published, n.notified)
+	}
+}
@@ -0,0 +1,253 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+	"github.com/princetheprogrammerbtw/nanoci/internal/events"
+	"github.com/princetheprogrammerbtw/nanoci/internal/logstore"
+	"github.com/princetheprogrammerbtw/nanoci/internal/runner"
+	"go.uber.org/zap"
+)
+
+// buildRun is the state shared by all steps of one build.
+type buildRun struct {
+	executor  *Executor
+	build     *domain.Build
+	pipeline  *domain.Pipeline
+	workspace string
+	env       map[string]string
+	masks     []string
+	log       io.Writer
+	stream    io.Writer // log without the setup log, for step output
+	steps     []*domain.BuildStep
+	images    *runner.ImagePuller
+	services  *runner.Services
+}
+
+type stepResult struct {
+	index  int
+	status domain.StepStatus
+	err    error
+}
+
+// runSteps runs the build's steps in dependency order, see schedule.
+func (r *buildRun) runSteps(ctx context.Context, deps [][]int) error {
+	return schedule(ctx, deps, r.decide, r.runStep, func(i int) {
+		r.executor.skipSteps(ctx, r.build, r.steps[i:i+1])
+	})
+}
+
+// verdict is what schedule does with a step once its dependencies have finished.
+type verdict int
+
+const (
+	// verdictRun starts the step.
+	verdictRun verdict = iota
+	// verdictSkip skips the step without holding back its dependents, as
+	// when its when: conditions do not match this build.
+	verdictSkip
+	// verdictBlock skips the step and every dependent that needs it to succeed.
+	verdictBlock
+)
+
+// decide evaluates the step's when: conditions and logs the outcome.
+func (r *buildRun) decide(i int, depsSucceeded, buildFailed bool) verdict {
+	step := r.pipeline.Steps[i]
+	if step.When == nil {
+		if depsSucceeded {
+			return verdictRun
+		}
+		return verdictBlock
+	}
+
+	match, notes := step.When.Match(r.build)
+	v := verdictRun
+	switch {
+	case !match:
+		v = verdictSkip
+	case step.When.Condition() == domain.ConditionOnFailure:
+		notes = append(notes, fmt.Sprintf("status on_failure: build has failed: %t", buildFailed))
+		if !buildFailed {
+			v = verdictSkip
+		}
+	case step.When.Condition() == domain.ConditionAlways:
+		notes = append(notes, "status always")
+	case !depsSucceeded:
+		v = verdictBlock
+	}
+
+	outcome := "running"
+	if v != verdictRun {
+		outcome = "skipped"
+	}
+	fmt.Fprintf(r.log, "==> %s: %s (%s)\n", step.Name, outcome, strings.Join(notes, "; "))
+	return v
+}
+
+// schedule starts every step as soon as all of its dependencies have
+// finished, so independent steps run concurrently. decide chooses whether
+// a ready step runs; a step that would start after ctx is done is skipped
+// instead. It returns the first step failure, if any.
+func schedule(
+	ctx context.Context,
+	deps [][]int,
+	decide func(i int, depsSucceeded, buildFailed bool) verdict,
+	run func(ctx context.Context, i int) (domain.StepStatus, error),
+	skip func(i int),
+) error {
+	n := len(deps)
+	status := make([]domain.StepStatus, n)
+	// passed marks steps that succeeded or were skipped by their conditions,
+	// after dependencies that passed in turn
+	passed := make([]bool, n)
+	started := make([]bool, n)
+	results := make(chan stepResult)
+	running := 0
+	failed := false
+	var firstErr error
+
+	for {
+		// Skipping a step can unblock its dependents, so sweep until nothing changes
+		for progress := true; progress; {
+			progress = false
+			for i := 0; i < n; i++ {
+				if started[i] || !finished(status, deps[i]) {
+					continue
+				}
+				started[i] = true
+				progress = true
+
+				v := verdictBlock
+				if ctx.Err() == nil {
+					v = decide(i, allPassed(passed, deps[i]), failed)
+				}
+				if v != verdictRun {
+					skip(i)
+					status[i] = domain.StepStatusSkipped
+					passed[i] = v == verdictSkip && allPassed(passed, deps[i])
+					continue
+				}
+
+				running++
+				go func(i int) {
+					s, err := run(ctx, i)
+					results <- stepResult{index: i, status: s, err: err}
+				}(i)
+			}
+		}
+
+		if running == 0 {
+			break
+		}
+		res := <-results
+		running--
+		status[res.index] = res.status
+		passed[res.index] = res.status == domain.StepStatusSuccess && allPassed(passed, deps[res.index])
+		if res.status != domain.StepStatusSuccess {
+			failed = true
+		}
+		if res.err != nil && firstErr == nil {
+			firstErr = res.err
+		}
+	}
+
+	// Steps skipped because the build was stopped between steps
+	if firstErr == nil && ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	return firstErr
+}
+
+func (r *buildRun) runStep(ctx context.Context, i int) (domain.StepStatus, error) {
+	step := r.pipeline.Steps[i]
+	stepRun := r.steps[i]
+	zap.L().Info("running step", zap.String("build_id", r.build.ID.String()), zap.String("name", step.Name))
+
+	// Merge project secrets and build variables into step env. The step's
+	// own env, which already carries any matrix values, is merged last so a
+	// pipeline can override a secret for one step.
+	mergedEnv := make(map[string]string)
+	for k, v := range r.env {
+		mergedEnv[k] = v
+	}
+	for k, v := range step.Env {
+		mergedEnv[k] = v
+	}
+
+	step.Env = mergedEnv
+
+	stepStart := time.Now()
+	stepRun.Status = domain.StepStatusRunning
+	stepRun.StartedAt = &stepStart
+	if err := r.executor.stepRepo.Update(ctx, stepRun); err != nil {
+		zap.L().Error("failed to update step", zap.String("name", step.Name), zap.Error(err))
+	}
+	r.executor.emit(ctx, events.StepStarted, r.build, stepRun)
+
+	fmt.Fprintf(r.log, "==> %s\n", step.Name)
+	stepLog := logstore.NewWriter(ctx, r.executor.logs, r.build.ID.String(), step.Name)
+	stepOut := NewMaskWriter(io.MultiWriter(r.stream, stepLog), r.masks)
+	defer stepLog.Close()
+	defer stepOut.Close()
+
+	image := r.pipeline.ImageFor(step)
+	if image == "" {
+		return r.failStep(ctx, stepRun, stepOut, fmt.Errorf("step %s has no image and the pipeline sets no default", step.Name))
+	}
+	if err := r.images.Pull(ctx, image); err != nil {
+		return r.failStep(ctx, stepRun, stepOut, fmt.Errorf("step %s: %w", step.Name, err))
+	}
+
+	exitCode, err := r.executor.runner.RunStep(ctx, image, step, r.workspace, r.services.Network, stepOut)
+	if err == nil {
+		stepRun.ExitCode = &exitCode
+	}
+	if err == nil && exitCode == 0 {
+		r.executor.finishStep(ctx, r.build, stepRun, domain.StepStatusSuccess)
+		return domain.StepStatusSuccess, nil
+	}
+
+	switch {
+	case errors.Is(err, runner.ErrStepTimeout):
+		err = fmt.Errorf("%w: step %s exceeded %s", runner.ErrStepTimeout, step.Name, step.Timeout)
+	case errors.Is(err, ErrBuildTimeout):
+		err = fmt.Errorf("%w: pipeline timeout of %s reached during step %s", ErrBuildTimeout, r.pipeline.Timeout, step.Name)
+	case err == nil:
+		err = fmt.Errorf("step %s failed with exit code %d", step.Name, exitCode)
+	}
+	return r.failStep(ctx, stepRun, stepOut, err)
+}
+
+// failStep reports err in the step's log and records the step's outcome.
+func (r *buildRun) failStep(ctx context.Context, stepRun *domain.BuildStep, out io.Writer, err error) (domain.StepStatus, error) {
+	fmt.Fprintf(out, "\n%s\n", err)
+
+	status := stepStatus(ctx, err)
+	r.executor.finishStep(ctx, r.build, stepRun, status)
+	return status, err
+}
+
+// finished reports whether every step in deps has reached a final status.
+func finished(status []domain.StepStatus, deps []int) bool {
+	for _, d := range deps {
+		if status[d] == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func allPassed(passed []bool, deps []int) bool {
+	for _, d := range deps {
+		if !passed[d] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,144 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/princetheprogrammerbtw/nanoci/internal/domain"
+)
+
+func TestScheduleRunsIndependentStepsConcurrently(t *testing.T) {
+	// lint and test are independent; build waits for both.
+	deps := [][]int{nil, nil, {0, 1}}
+
+	var mu sync.Mutex
+	var order []int
+	bothStarted := make(chan struct{})
+	var startedCount int
+
+	run := func(ctx context.Context, i int) (domain.StepStatus, error) {
+		mu.Lock()
+		order = append(order, i)
+		if i < 2 {
+			startedCount++
+			if startedCount == 2 {
+				close(bothStarted)
+			}
+		}
+		mu.Unlock()
+
+		if i < 2 {
+			// Neither root can finish until the other has started
+			select {
+			case <-bothStarted:
+			case <-time.After(time.Second):
+				return domain.StepStatusFailed, errors.New("steps did not run concurrently")
+			}
+		}
+		return domain.StepStatusSuccess, nil
+	}
+
+	if err := schedule(context.Background(), deps, onSuccess, run, func(int) { t.Error("unexpected skip") }); err != nil {
+		t.Fatalf("schedule failed: %v", err)
+	}
+	if len(order) != 3 || order[2] != 2 {
+		t.Errorf("Expected build to run last, got order %v", order)
+	}
+}
+
+func TestScheduleSkipsDependentsOfFailedSteps(t *testing.T) {
+	// a fails; b depends on a; c depends on b; d is independent.
+	deps := [][]int{nil, {0}, {1}, nil}
+	failure := errors.New("a failed")
+
+	var mu sync.Mutex
+	ran := map[int]bool{}
+	skipped := map[int]bool{}
+
+	run := func(ctx context.Context, i int) (domain.StepStatus, error) {
+		mu.Lock()
+		ran[i] = true
+		mu.Unlock()
+		if i == 0 {
+			return domain.StepStatusFailed, failure
+		}
+		return domain.StepStatusSuccess, nil
+	}
+	skip := func(i int) { skipped[i] = true }
+
+	err := schedule(context.Background(), deps, onSuccess, run, skip)
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected %v, got %v", failure, err)
+	}
+	if !ran[0] || !ran[3] || ran[1] || ran[2] {
+		t.Errorf("Unexpected steps ran: %v", ran)
+	}
+	if !skipped[1] || !skipped[2] {
+		t.Errorf("Expected dependents to be skipped, got %v", skipped)
+	}
+}
+
+// onSuccess is the decision for steps without when: conditions.
+func onSuccess(i int, depsSucceeded, buildFailed bool) verdict {
+	if depsSucceeded {
+		return verdictRun
+	}
+	return verdictBlock
+}
+
+func TestScheduleHonoursStatusConditions(t *testing.T) {
+	// test fails, so deploy is held back while notify (on_failure) and
+	// cleanup (always) still run. docs is excluded by its conditions, which
+	// does not hold back publish.
+	const (
+		test = iota
+		deploy
+		notify
+		cleanup
+		docs
+		publish
+	)
+	deps := [][]int{nil, {test}, {test}, {notify}, nil, {docs}}
+	failure := errors.New("test failed")
+
+	decide := func(i int, depsSucceeded, buildFailed bool) verdict {
+		switch i {
+		case notify:
+			if buildFailed {
+				return verdictRun
+			}
+			return verdictSkip
+		case cleanup:
+			return verdictRun
+		case docs:
+			return verdictSkip
+		}
+		return onSuccess(i, depsSucceeded, buildFailed)
+	}
+
+	var mu sync.Mutex
+	ran := map[int]bool{}
+	run := func(ctx context.Context, i int) (domain.StepStatus, error) {
+		mu.Lock()
+		ran[i] = true
+		mu.Unlock()
+		if i == test {
+			return domain.StepStatusFailed, failure
+		}
+		return domain.StepStatusSuccess, nil
+	}
+
+	err := schedule(context.Background(), deps, decide, run, func(int) {})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected %v, got %v", failure, err)
+	}
+	if ran[deploy] || ran[docs] {
+		t.Errorf("Expected deploy and docs to be skipped, got %v", ran)
+	}
+	if !ran[notify] || !ran[cleanup] || !ran[publish] {
+		t.Errorf("Expected notify, cleanup and publish to run, got %v", ran)
+	}
+}
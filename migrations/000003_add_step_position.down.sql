@@ -0,0 +1,3 @@
+-- 000003_add_step_position.down.sql
+
+ALTER TABLE steps DROP COLUMN IF EXISTS position;
@@ -0,0 +1,3 @@
+-- 000003_add_step_position.up.sql
+
+ALTER TABLE steps ADD COLUMN IF NOT EXISTS position INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+-- 000004_add_project_credentials.down.sql
+
+ALTER TABLE projects DROP COLUMN IF EXISTS encrypted_credential;
+ALTER TABLE projects DROP COLUMN IF EXISTS credential_type;
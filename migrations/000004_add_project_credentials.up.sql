@@ -0,0 +1,4 @@
+-- 000004_add_project_credentials.up.sql
+
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS credential_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS encrypted_credential TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+-- 000005_add_build_event.down.sql
+
+ALTER TABLE builds DROP COLUMN IF EXISTS changed_files;
+ALTER TABLE builds DROP COLUMN IF EXISTS event;
@@ -0,0 +1,4 @@
+-- 000005_add_build_event.up.sql
+
+ALTER TABLE builds ADD COLUMN IF NOT EXISTS event TEXT NOT NULL DEFAULT 'push';
+ALTER TABLE builds ADD COLUMN IF NOT EXISTS changed_files TEXT[] NOT NULL DEFAULT '{}';
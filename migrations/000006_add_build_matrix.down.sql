@@ -0,0 +1,5 @@
+-- 000006_add_build_matrix.down.sql
+
+DROP INDEX IF EXISTS idx_builds_parent_id;
+ALTER TABLE builds DROP COLUMN IF EXISTS matrix;
+ALTER TABLE builds DROP COLUMN IF EXISTS parent_id;
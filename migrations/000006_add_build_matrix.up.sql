@@ -0,0 +1,6 @@
+-- 000006_add_build_matrix.up.sql
+
+ALTER TABLE builds ADD COLUMN IF NOT EXISTS parent_id UUID REFERENCES builds(id) ON DELETE CASCADE;
+ALTER TABLE builds ADD COLUMN IF NOT EXISTS matrix JSONB;
+
+CREATE INDEX IF NOT EXISTS idx_builds_parent_id ON builds(parent_id);
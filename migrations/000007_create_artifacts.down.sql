@@ -0,0 +1,3 @@
+-- 000007_create_artifacts.down.sql
+
+DROP TABLE IF EXISTS artifacts;
@@ -0,0 +1,16 @@
+-- 000007_create_artifacts.up.sql
+
+CREATE TABLE IF NOT EXISTS artifacts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    build_id UUID REFERENCES builds(id) ON DELETE CASCADE,
+    path TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    digest TEXT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(build_id, path)
+);
+
+CREATE INDEX idx_artifacts_build_id ON artifacts(build_id);
+CREATE INDEX idx_artifacts_digest ON artifacts(digest);
+CREATE INDEX idx_artifacts_expires_at ON artifacts(expires_at);
@@ -0,0 +1,4 @@
+-- 000008_create_notifications.down.sql
+
+DROP TABLE IF EXISTS notification_deliveries;
+DROP TABLE IF EXISTS notification_targets;
@@ -0,0 +1,28 @@
+-- 000008_create_notifications.up.sql
+
+CREATE TABLE IF NOT EXISTS notification_targets (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    project_id UUID REFERENCES projects(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    url TEXT NOT NULL DEFAULT '',
+    recipients TEXT[] NOT NULL DEFAULT '{}',
+    notify_on TEXT NOT NULL DEFAULT 'always',
+    branches TEXT[] NOT NULL DEFAULT '{}',
+    encrypted_secret TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS notification_deliveries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    target_id UUID REFERENCES notification_targets(id) ON DELETE CASCADE,
+    build_id UUID REFERENCES builds(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'PENDING',
+    attempts INT NOT NULL DEFAULT 0,
+    response_code INT,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_notification_targets_project_id ON notification_targets(project_id);
+CREATE INDEX idx_notification_deliveries_target_id ON notification_deliveries(target_id, created_at);
@@ -0,0 +1,5 @@
+-- 000009_add_build_pull_request.down.sql
+
+ALTER TABLE builds DROP COLUMN IF EXISTS fork;
+ALTER TABLE builds DROP COLUMN IF EXISTS source_branch;
+ALTER TABLE builds DROP COLUMN IF EXISTS pr_number;
@@ -0,0 +1,5 @@
+-- 000009_add_build_pull_request.up.sql
+
+ALTER TABLE builds ADD COLUMN IF NOT EXISTS pr_number INT;
+ALTER TABLE builds ADD COLUMN IF NOT EXISTS source_branch TEXT NOT NULL DEFAULT '';
+ALTER TABLE builds ADD COLUMN IF NOT EXISTS fork BOOLEAN NOT NULL DEFAULT FALSE;
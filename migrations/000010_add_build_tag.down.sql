@@ -0,0 +1,3 @@
+-- 000010_add_build_tag.down.sql
+
+ALTER TABLE builds DROP COLUMN IF EXISTS tag;
@@ -0,0 +1,3 @@
+-- 000010_add_build_tag.up.sql
+
+ALTER TABLE builds ADD COLUMN IF NOT EXISTS tag TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,6 @@
+-- 000011_add_project_provider.down.sql
+
+ALTER TABLE projects DROP CONSTRAINT IF EXISTS projects_provider_repo_id_key;
+ALTER TABLE projects RENAME COLUMN repo_id TO github_repo_id;
+ALTER TABLE projects ADD CONSTRAINT projects_github_repo_id_key UNIQUE (github_repo_id);
+ALTER TABLE projects DROP COLUMN IF EXISTS provider;
@@ -0,0 +1,8 @@
+-- 000011_add_project_provider.up.sql
+
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS provider TEXT NOT NULL DEFAULT 'github';
+ALTER TABLE projects RENAME COLUMN github_repo_id TO repo_id;
+
+-- Repository IDs are only unique within a provider
+ALTER TABLE projects DROP CONSTRAINT IF EXISTS projects_github_repo_id_key;
+ALTER TABLE projects ADD CONSTRAINT projects_provider_repo_id_key UNIQUE (provider, repo_id);
@@ -0,0 +1,3 @@
+-- 000012_create_webhook_deliveries.down.sql
+
+DROP TABLE IF EXISTS webhook_deliveries;
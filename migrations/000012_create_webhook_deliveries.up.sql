@@ -0,0 +1,19 @@
+-- 000012_create_webhook_deliveries.up.sql
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    project_id UUID REFERENCES projects(id) ON DELETE CASCADE,
+    delivery_id TEXT NOT NULL DEFAULT '',
+    event TEXT NOT NULL DEFAULT '',
+    payload_hash TEXT NOT NULL,
+    payload BYTEA NOT NULL,
+    outcome TEXT NOT NULL DEFAULT 'pending',
+    error TEXT NOT NULL DEFAULT '',
+    build_id UUID REFERENCES builds(id) ON DELETE SET NULL,
+    redelivery_of UUID REFERENCES webhook_deliveries(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Providers retry deliveries with the same ID; each is only acted on once
+CREATE UNIQUE INDEX idx_webhook_deliveries_delivery_id ON webhook_deliveries(project_id, delivery_id) WHERE delivery_id <> '';
+CREATE INDEX idx_webhook_deliveries_project_id ON webhook_deliveries(project_id, created_at);
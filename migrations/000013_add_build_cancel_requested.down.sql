@@ -0,0 +1,3 @@
+-- 000013_add_build_cancel_requested.down.sql
+
+ALTER TABLE builds DROP COLUMN IF EXISTS cancel_requested;
@@ -0,0 +1,3 @@
+-- 000013_add_build_cancel_requested.up.sql
+
+ALTER TABLE builds ADD COLUMN IF NOT EXISTS cancel_requested BOOLEAN NOT NULL DEFAULT false;
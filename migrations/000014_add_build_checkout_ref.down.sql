@@ -0,0 +1,3 @@
+-- 000014_add_build_checkout_ref.down.sql
+
+ALTER TABLE builds DROP COLUMN IF EXISTS checkout_ref;
@@ -0,0 +1,3 @@
+-- 000014_add_build_checkout_ref.up.sql
+
+ALTER TABLE builds ADD COLUMN IF NOT EXISTS checkout_ref TEXT NOT NULL DEFAULT '';
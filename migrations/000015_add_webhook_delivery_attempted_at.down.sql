@@ -0,0 +1,4 @@
+-- 000015_add_webhook_delivery_attempted_at.down.sql
+
+DROP INDEX IF EXISTS idx_webhook_deliveries_created_at;
+ALTER TABLE webhook_deliveries DROP COLUMN IF EXISTS attempted_at;
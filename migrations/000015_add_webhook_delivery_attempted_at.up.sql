@@ -0,0 +1,6 @@
+-- 000015_add_webhook_delivery_attempted_at.up.sql
+
+-- When the delivery was last claimed for evaluation; a pending delivery
+-- whose claim is stale may be retried
+ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS attempted_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_created_at ON webhook_deliveries(created_at);
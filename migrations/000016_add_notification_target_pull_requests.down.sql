@@ -0,0 +1,3 @@
+-- 000016_add_notification_target_pull_requests.down.sql
+
+ALTER TABLE notification_targets DROP COLUMN IF EXISTS pull_requests;
@@ -0,0 +1,4 @@
+-- 000016_add_notification_target_pull_requests.up.sql
+
+-- Branch-filtered targets skip pull requests into those branches unless set
+ALTER TABLE notification_targets ADD COLUMN IF NOT EXISTS pull_requests BOOLEAN NOT NULL DEFAULT FALSE;
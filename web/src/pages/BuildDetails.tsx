@@ -1,7 +1,7 @@
 import { useEffect, useState, useRef } from 'react';
 import { useParams, Link } from 'react-router-dom';
 import { api } from '../lib/api';
-import { Build } from '../types';
+import { Build, LogMessage } from '../types';
 import { Terminal } from 'lucide-react';
 
 export function BuildDetails() {
@@ -10,6 +10,7 @@ export function BuildDetails() {
   const [logs, setLogs] = useState<string[]>([]);
   const logsEndRef = useRef<HTMLDivElement>(null);
   const wsRef = useRef<WebSocket | null>(null);
+  const lastSeqRef = useRef<string | null>(null);
 
   useEffect(() => {
     if (!id) return;
@@ -20,16 +21,35 @@ export function BuildDetails() {
 
     // Setup WebSocket
     // Note: Hardcoding WS URL for now, should be dynamic
-    const ws = new WebSocket(`ws://localhost:8080/ws/logs/${id}`);
-    
-    ws.onmessage = (event) => {
-      setLogs(prev => [...prev, event.data]);
-    };
+    // The server replays the backlog after `since` and then follows live output,
+    // so reconnecting with the last seen seq never drops or repeats lines.
+    // Once the build has finished it sends an `end` message and closes.
+    let closed = false;
+    const connect = () => {
+      const since = lastSeqRef.current ? `?since=${lastSeqRef.current}` : '';
+      const ws = new WebSocket(`ws://localhost:8080/ws/logs/${id}${since}`);
+
+      ws.onmessage = (event) => {
+        const msg: LogMessage = JSON.parse(event.data);
+        if (msg.end) {
+          closed = true;
+          return;
+        }
+        lastSeqRef.current = msg.seq;
+        setLogs(prev => [...prev, msg.data]);
+      };
 
-    wsRef.current = ws;
+      ws.onclose = () => {
+        if (!closed) setTimeout(connect, 2000);
+      };
+
+      wsRef.current = ws;
+    };
+    connect();
 
     return () => {
-      ws.close();
+      closed = true;
+      wsRef.current?.close();
     };
   }, [id]);
 
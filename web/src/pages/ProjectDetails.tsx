@@ -1,7 +1,7 @@
 import { useEffect, useState } from 'react';
 import { useParams, Link } from 'react-router-dom';
 import { api } from '../lib/api';
-import { Project, Build } from '../types';
+import { Project, Build, BuildEventMessage } from '../types';
 import { format } from 'date-fns';
 import { CheckCircle, XCircle, Clock, Loader, PlayCircle } from 'lucide-react';
 import { cn } from '../lib/utils';
@@ -27,6 +27,39 @@ export function ProjectDetails() {
     .finally(() => setLoading(false));
   }, [id]);
 
+  // Keep the build list current from the event stream instead of polling
+  useEffect(() => {
+    if (!id) return;
+
+    let closed = false;
+    let lastID = '';
+    let ws: WebSocket;
+    const connect = () => {
+      const since = lastID ? `&since=${lastID}` : '';
+      ws = new WebSocket(`ws://localhost:8080/ws/events?project_id=${id}${since}`);
+
+      ws.onmessage = (message) => {
+        const event: BuildEventMessage = JSON.parse(message.data);
+        lastID = event.id;
+        if (event.build.parent_id) return;
+        setBuilds(prev => {
+          const rest = prev.filter(b => b.id !== event.build.id);
+          return rest.length === prev.length ? [event.build, ...prev] : prev.map(b => b.id === event.build.id ? event.build : b);
+        });
+      };
+
+      ws.onclose = () => {
+        if (!closed) setTimeout(connect, 2000);
+      };
+    };
+    connect();
+
+    return () => {
+      closed = true;
+      ws.close();
+    };
+  }, [id]);
+
   if (loading) return <div className="p-8 text-white">Loading...</div>;
   if (!project) return <div className="p-8 text-white">Project not found</div>;
 
@@ -13,12 +13,19 @@ export interface Project {
   user_id: string;
   name: string;
   repo_url: string;
+  provider: "github" | "gitlab" | "gitea";
+  repo_id: string;
   default_branch: string;
+  credential_type: "" | "token" | "ssh_key";
+  // Only returned when the project is created or its secret rotated
+  webhook_secret?: string;
   created_at: string;
   updated_at: string;
 }
 
-export type BuildStatus = "PENDING" | "RUNNING" | "SUCCESS" | "FAILED" | "CANCELLED";
+export type BuildStatus = "PENDING" | "RUNNING" | "SUCCESS" | "FAILED" | "CANCELLED" | "TIMED_OUT";
+
+export type BuildEvent = "push" | "pull_request" | "tag" | "manual";
 
 export interface Build {
   id: string;
@@ -26,15 +33,111 @@ export interface Build {
   commit_hash: string;
   commit_message: string;
   branch: string;
+  tag?: string;
+  event: BuildEvent;
+  changed_files: string[];
+  pr_number?: number;
+  source_branch?: string;
+  checkout_ref?: string;
+  fork: boolean;
+  parent_id?: string;
+  matrix?: Record<string, string>;
   status: BuildStatus;
+  cancel_requested: boolean;
   started_at?: string;
   finished_at?: string;
   created_at: string;
 }
 
+export type StepStatus = "PENDING" | "RUNNING" | "SUCCESS" | "FAILED" | "SKIPPED" | "CANCELLED" | "TIMED_OUT";
+
+export interface BuildStep {
+  id: string;
+  build_id: string;
+  name: string;
+  position: number;
+  status: StepStatus;
+  exit_code?: number;
+  started_at?: string;
+  finished_at?: string;
+}
+
+export interface LogMessage {
+  seq: string;
+  data: string;
+  end?: boolean;
+}
+
+export type EventType = "build.queued" | "build.started" | "step.started" | "step.finished" | "build.finished";
+
+export interface BuildEventMessage {
+  id: string;
+  type: EventType;
+  time: string;
+  project_id: string;
+  build_id: string;
+  build: Build;
+  step?: BuildStep;
+}
+
 export interface Secret {
   id: string;
   project_id: string;
   key: string;
   created_at: string;
 }
+
+export interface Artifact {
+  id: string;
+  build_id: string;
+  path: string;
+  size: number;
+  digest: string;
+  expires_at: string;
+  created_at: string;
+}
+
+export type NotificationKind = "webhook" | "slack" | "email";
+
+export type NotifyOn = "always" | "failure" | "change";
+
+export interface NotificationTarget {
+  id: string;
+  project_id: string;
+  kind: NotificationKind;
+  url?: string;
+  recipients?: string[];
+  on: NotifyOn;
+  branches: string[];
+  pull_requests: boolean;
+  created_at: string;
+}
+
+export type DeliveryStatus = "PENDING" | "DELIVERED" | "FAILED";
+
+export interface NotificationDelivery {
+  id: string;
+  target_id: string;
+  build_id: string;
+  status: DeliveryStatus;
+  attempts: number;
+  response_code?: number;
+  error?: string;
+  created_at: string;
+  updated_at: string;
+}
+
+export type WebhookOutcome = "pending" | "triggered" | "ignored" | "invalid" | "failed";
+
+export interface WebhookDelivery {
+  id: string;
+  project_id: string;
+  delivery_id: string;
+  event: string;
+  payload_hash: string;
+  outcome: WebhookOutcome;
+  error?: string;
+  build_id?: string;
+  redelivery_of?: string;
+  created_at: string;
+}